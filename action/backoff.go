@@ -0,0 +1,268 @@
+package action
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/altairsix/pkg/clock"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// Jitter identifies the strategy used to randomize the delay between attempts
+type Jitter int
+
+const (
+	// JitterDefault varies each delay by +/- 20%
+	JitterDefault Jitter = iota
+
+	// JitterNone uses the computed delay as is
+	JitterNone
+
+	// JitterFull picks a random delay between 0 and the computed delay
+	JitterFull
+
+	// JitterDecorrelated picks a random delay between the initial delay and 3x the previous delay
+	JitterDecorrelated
+)
+
+type permanentErr struct {
+	cause error
+}
+
+func (p permanentErr) Error() string { return p.cause.Error() }
+func (p permanentErr) Cause() error  { return p.cause }
+
+// Permanent marks err as an error that should never be retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentErr{cause: err}
+}
+
+// IsPermanent returns true if err, or any of its causes, was marked with Permanent
+func IsPermanent(err error) bool {
+	return tracer.HasErr(err, func(err error) bool {
+		_, ok := err.(permanentErr)
+		return ok
+	})
+}
+
+// IsRetryable is the default predicate used by Backoff; all errors other than those
+// marked Permanent are considered retryable
+func IsRetryable(err error) bool {
+	return err != nil && !IsPermanent(err)
+}
+
+type backoff struct {
+	clock          clock.Clock
+	initial        time.Duration
+	max            time.Duration
+	multiplier     float64
+	jitter         Jitter
+	maxAttempts    int
+	attemptTimeout time.Duration
+	deadline       time.Duration
+	retryable      func(err error) bool
+}
+
+// delay returns the amount of time to wait after the specified attempt (0 based)
+func (b *backoff) delay(attempt int, prev time.Duration) time.Duration {
+	if b.jitter == JitterDecorrelated {
+		if prev <= 0 {
+			prev = b.initial
+		}
+		return decorrelatedJitter(b.initial, prev, b.max)
+	}
+
+	d := float64(b.initial)
+	for i := 0; i < attempt; i++ {
+		d *= b.multiplier
+		if b.max > 0 && d >= float64(b.max) {
+			break
+		}
+		if d >= math.MaxInt64 {
+			d = math.MaxInt64
+			break
+		}
+	}
+
+	delay := time.Duration(d)
+	if b.max > 0 && delay > b.max {
+		delay = b.max
+	}
+
+	switch b.jitter {
+	case JitterNone:
+		return delay
+	case JitterFull:
+		return fullJitter(delay)
+	default:
+		return jitter(delay)
+	}
+}
+
+// BackoffOption provides functional options to Backoff
+type BackoffOption interface {
+	applyBackoff(*backoff)
+}
+
+type backoffFunc func(*backoff)
+
+func (fn backoffFunc) applyBackoff(v *backoff) { fn(v) }
+
+// WithInitialDelay specifies the delay after the first failed attempt
+func WithInitialDelay(d time.Duration) BackoffOption {
+	return backoffFunc(func(b *backoff) {
+		b.initial = d
+	})
+}
+
+// WithMaxDelay caps the delay between attempts
+func WithMaxDelay(d time.Duration) BackoffOption {
+	return backoffFunc(func(b *backoff) {
+		b.max = d
+	})
+}
+
+// WithMultiplier specifies the growth factor applied to the delay after each failed attempt
+func WithMultiplier(m float64) BackoffOption {
+	return backoffFunc(func(b *backoff) {
+		b.multiplier = m
+	})
+}
+
+// WithJitter specifies the jitter strategy
+func WithJitter(j Jitter) BackoffOption {
+	return backoffFunc(func(b *backoff) {
+		b.jitter = j
+	})
+}
+
+// WithMaxAttempts specifies the maximum number of attempts including the first; 0 means unlimited
+func WithMaxAttempts(n int) BackoffOption {
+	return backoffFunc(func(b *backoff) {
+		b.maxAttempts = n
+	})
+}
+
+// WithAttemptTimeout bounds the amount of time any single attempt may take
+func WithAttemptTimeout(d time.Duration) BackoffOption {
+	return backoffFunc(func(b *backoff) {
+		b.attemptTimeout = d
+	})
+}
+
+// WithDeadline bounds the total amount of time spent across all attempts
+func WithDeadline(d time.Duration) BackoffOption {
+	return backoffFunc(func(b *backoff) {
+		b.deadline = d
+	})
+}
+
+// WithRetryable specifies the predicate that decides whether an error should be retried
+func WithRetryable(fn func(err error) bool) BackoffOption {
+	return backoffFunc(func(b *backoff) {
+		b.retryable = fn
+	})
+}
+
+func newBackoff(opts ...BackoffOption) *backoff {
+	cfg := &backoff{
+		clock:       clock.System,
+		initial:     time.Millisecond * 100,
+		max:         time.Second * 30,
+		multiplier:  2,
+		jitter:      JitterDefault,
+		maxAttempts: 5,
+		retryable:   IsRetryable,
+	}
+
+	for _, opt := range opts {
+		opt.applyBackoff(cfg)
+	}
+
+	return cfg
+}
+
+// BackoffDelays returns the delay Backoff would wait after the specified attempt (0 based) for the
+// options provided; useful for pacing retries that are driven outside of Backoff.  Decorrelated
+// jitter is computed from the initial delay as there is no previous delay to draw from.
+func BackoffDelays(opts ...BackoffOption) func(attempt int) time.Duration {
+	cfg := newBackoff(opts...)
+
+	return func(attempt int) time.Duration {
+		return cfg.delay(attempt, 0)
+	}
+}
+
+// Backoff retries failed actions with an exponentially increasing, jittered delay.  Errors
+// rejected by the retryable predicate are returned immediately.
+func Backoff(opts ...BackoffOption) Filter {
+	cfg := newBackoff(opts...)
+
+	return func(a Action) Action {
+		attemptOnce := func(ctx context.Context) error {
+			if cfg.attemptTimeout <= 0 {
+				return a.Do(ctx)
+			}
+
+			child, cancel := clock.WithTimeout(ctx, cfg.clock, cfg.attemptTimeout)
+			defer cancel()
+
+			return a.Do(child)
+		}
+
+		return func(ctx context.Context) (err error) {
+			segment, ctx := tracer.NewSegment(ctx, "action:backoff")
+			defer segment.Finish()
+
+			if cfg.deadline > 0 {
+				var cancel func()
+				ctx, cancel = clock.WithTimeout(ctx, cfg.clock, cfg.deadline)
+				defer cancel()
+			}
+
+			var delay time.Duration
+			for attempt := 0; cfg.maxAttempts <= 0 || attempt < cfg.maxAttempts; attempt++ {
+				startedAt := cfg.clock.Now()
+				if err = attemptOnce(ctx); err == nil {
+					segment.Info("backoff:ok",
+						log.Int("attempt", attempt+1),
+						log.Int64("elapsed-ms", int64(cfg.clock.Since(startedAt)/time.Millisecond)),
+					)
+					return nil
+				}
+
+				if !cfg.retryable(err) {
+					segment.Info("backoff:not_retryable", log.Int("attempt", attempt+1), log.Error(err))
+					return err
+				}
+
+				if cfg.maxAttempts > 0 && attempt+1 >= cfg.maxAttempts {
+					break
+				}
+
+				delay = cfg.delay(attempt, delay)
+				segment.Info("backoff:failed",
+					log.Int("attempt", attempt+1),
+					log.Int64("elapsed-ms", int64(cfg.clock.Since(startedAt)/time.Millisecond)),
+					log.Int64("delay-ms", int64(delay/time.Millisecond)),
+					log.Error(err),
+				)
+
+				select {
+				case <-ctx.Done():
+					segment.Info("backoff:canceled", log.Error(ctx.Err()))
+					return err
+				case <-cfg.clock.After(delay):
+				}
+			}
+
+			segment.Info("backoff:exhausted", log.Error(err))
+			return err
+		}
+	}
+}
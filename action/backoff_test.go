@@ -0,0 +1,155 @@
+package action_test
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	backoff := action.Backoff(
+		action.WithInitialDelay(time.Millisecond*5),
+		action.WithMaxDelay(time.Millisecond*20),
+		action.WithMaxAttempts(4),
+	)
+
+	t.Run("only 1 call on success", func(t *testing.T) {
+		calls := int32(0)
+		err := backoff.AndThen(Run(&calls)).Do(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1), calls)
+	})
+
+	t.Run("returns err if never succeeds", func(t *testing.T) {
+		calls := int32(0)
+		a := func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return io.ErrUnexpectedEOF
+		}
+		err := backoff.AndThen(a).Do(ctx)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Equal(t, int32(4), calls)
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		calls := int32(0)
+		a := func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return errors.Wrap(action.Permanent(io.ErrUnexpectedEOF), "wrapped")
+		}
+		err := backoff.AndThen(a).Do(ctx)
+		assert.True(t, action.IsPermanent(err))
+		assert.Equal(t, int32(1), calls)
+	})
+
+	t.Run("custom retryable predicate", func(t *testing.T) {
+		calls := int32(0)
+		a := func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return io.EOF
+		}
+		filter := action.Backoff(
+			action.WithInitialDelay(time.Millisecond),
+			action.WithRetryable(func(err error) bool { return err != io.EOF }),
+		)
+		err := filter.AndThen(a).Do(ctx)
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, int32(1), calls)
+	})
+}
+
+func TestBackoffTimeouts(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("attempt timeout", func(t *testing.T) {
+		calls := int32(0)
+		a := func(ctx context.Context) error {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		}
+		filter := action.Backoff(
+			action.WithInitialDelay(time.Millisecond),
+			action.WithAttemptTimeout(time.Millisecond*25),
+		)
+		err := filter.AndThen(a).Do(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(2), calls)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		a := func(ctx context.Context) error {
+			return io.ErrUnexpectedEOF
+		}
+		filter := action.Backoff(
+			action.WithInitialDelay(time.Millisecond*10),
+			action.WithJitter(action.JitterFull),
+			action.WithMaxAttempts(0),
+			action.WithDeadline(time.Millisecond*100),
+		)
+
+		startedAt := time.Now()
+		err := filter.AndThen(a).Do(ctx)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.True(t, time.Since(startedAt) < time.Millisecond*500)
+	})
+
+	t.Run("decorrelated jitter", func(t *testing.T) {
+		calls := int32(0)
+		a := func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return io.ErrUnexpectedEOF
+		}
+		filter := action.Backoff(
+			action.WithInitialDelay(time.Millisecond),
+			action.WithMaxDelay(time.Millisecond*5),
+			action.WithJitter(action.JitterDecorrelated),
+			action.WithMaxAttempts(5),
+		)
+		err := filter.AndThen(a).Do(ctx)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Equal(t, int32(5), calls)
+	})
+}
+
+func TestBackoffClock(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Now())
+	calls := int32(0)
+	a := func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return io.ErrUnexpectedEOF
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- action.Backoff(
+			action.WithInitialDelay(time.Hour),
+			action.WithJitter(action.JitterNone),
+			action.WithMaxAttempts(3),
+			action.WithClock(fake),
+		).AndThen(a).Do(context.Background())
+	}()
+
+	for i := 1; i < 3; i++ {
+		fake.BlockUntil(1)
+		assert.Equal(t, int32(i), atomic.LoadInt32(&calls))
+		fake.Advance(time.Hour * time.Duration(i))
+	}
+
+	assert.Equal(t, io.ErrUnexpectedEOF, <-done)
+	assert.Equal(t, int32(3), calls)
+}
@@ -0,0 +1,325 @@
+package action
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/altairsix/pkg/clock"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// BreakerState identifies the state of a CircuitBreaker
+type BreakerState int
+
+const (
+	// StateClosed allows all calls through to the action
+	StateClosed BreakerState = iota
+
+	// StateOpen rejects all calls with ErrCircuitOpen until the cool down has elapsed
+	StateOpen
+
+	// StateHalfOpen allows a limited number of trial calls through to the action
+	StateHalfOpen
+)
+
+// String renders the BreakerState as a string
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown:" + strconv.Itoa(int(s))
+	}
+}
+
+// ErrCircuitOpen is returned when a call is rejected by an open CircuitBreaker
+type ErrCircuitOpen struct {
+	// Name of the CircuitBreaker that rejected the call
+	Name string
+
+	// RetryAt indicates when the breaker will next allow a trial call
+	RetryAt time.Time
+}
+
+// Error implements the error interface
+func (e *ErrCircuitOpen) Error() string {
+	return "circuit breaker, " + e.Name + ", is open until " + e.RetryAt.Format(time.RFC3339)
+}
+
+// IsCircuitOpen returns true if err, or any of its causes, is an *ErrCircuitOpen
+func IsCircuitOpen(err error) bool {
+	return tracer.HasErr(err, func(err error) bool {
+		_, ok := err.(*ErrCircuitOpen)
+		return ok
+	})
+}
+
+type breaker struct {
+	clock               clock.Clock
+	consecutiveFailures int
+	failureRate         float64
+	minRequests         int
+	window              time.Duration
+	coolDown            time.Duration
+	halfOpenRequests    int
+	isFailure           func(err error) bool
+}
+
+// BreakerOption provides functional options to NewCircuitBreaker
+type BreakerOption interface {
+	applyBreaker(*breaker)
+}
+
+type breakerFunc func(*breaker)
+
+func (fn breakerFunc) applyBreaker(v *breaker) { fn(v) }
+
+// WithConsecutiveFailures opens the circuit after n consecutive failures; 0 disables the check
+func WithConsecutiveFailures(n int) BreakerOption {
+	return breakerFunc(func(b *breaker) {
+		b.consecutiveFailures = n
+	})
+}
+
+// WithFailureRate opens the circuit when the ratio of failures to calls within the window
+// reaches rate, provided at least minRequests calls were made; a rate of 0 disables the check
+func WithFailureRate(rate float64, minRequests int) BreakerOption {
+	return breakerFunc(func(b *breaker) {
+		b.failureRate = rate
+		b.minRequests = minRequests
+	})
+}
+
+// WithWindow specifies the period over which the failure rate is measured
+func WithWindow(d time.Duration) BreakerOption {
+	return breakerFunc(func(b *breaker) {
+		b.window = d
+	})
+}
+
+// WithCoolDown specifies how long the circuit remains open before allowing trial calls
+func WithCoolDown(d time.Duration) BreakerOption {
+	return breakerFunc(func(b *breaker) {
+		b.coolDown = d
+	})
+}
+
+// WithHalfOpenRequests specifies the number of trial calls that must succeed before closing the circuit
+func WithHalfOpenRequests(n int) BreakerOption {
+	return breakerFunc(func(b *breaker) {
+		b.halfOpenRequests = n
+	})
+}
+
+// WithFailurePredicate specifies which errors count as failures.  By default, all errors
+// count other than cancellation of the caller's context.
+func WithFailurePredicate(fn func(err error) bool) BreakerOption {
+	return breakerFunc(func(b *breaker) {
+		b.isFailure = fn
+	})
+}
+
+// CircuitBreaker prevents calls to an action that is known to be failing
+type CircuitBreaker struct {
+	name string
+	cfg  *breaker
+
+	mutex       sync.Mutex
+	state       BreakerState
+	generation  int // incremented on each change of state
+	openedAt    time.Time
+	windowStart time.Time
+	requests    int
+	failures    int
+	consecutive int
+	inFlight    int
+	successes   int
+}
+
+// NewCircuitBreaker returns a new CircuitBreaker.  The breaker is shared by every Action
+// wrapped with its Filter.
+func NewCircuitBreaker(name string, opts ...BreakerOption) *CircuitBreaker {
+	cfg := &breaker{
+		clock:               clock.System,
+		consecutiveFailures: 5,
+		failureRate:         0.5,
+		minRequests:         20,
+		window:              time.Minute,
+		coolDown:            time.Second * 30,
+		halfOpenRequests:    1,
+	}
+
+	for _, opt := range opts {
+		opt.applyBreaker(cfg)
+	}
+
+	if cfg.halfOpenRequests <= 0 {
+		cfg.halfOpenRequests = 1
+	}
+
+	return &CircuitBreaker{
+		name:        name,
+		cfg:         cfg,
+		windowStart: cfg.clock.Now(),
+	}
+}
+
+// State returns the current state of the breaker
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state == StateOpen && !cb.cfg.clock.Now().Before(cb.openedAt.Add(cb.cfg.coolDown)) {
+		return StateHalfOpen
+	}
+	return cb.state
+}
+
+// setState must be called while holding the mutex
+func (cb *CircuitBreaker) setState(segment tracer.Segment, state BreakerState, now time.Time) {
+	if cb.state == state {
+		return
+	}
+
+	segment.Info("circuit_breaker:"+state.String(),
+		log.String("breaker", cb.name),
+		log.String("from", cb.state.String()),
+		log.Int("requests", cb.requests),
+		log.Int("failures", cb.failures),
+		log.Int("consecutive", cb.consecutive),
+	)
+
+	cb.state = state
+	cb.generation++
+	cb.inFlight = 0
+	cb.windowStart = now
+	cb.requests = 0
+	cb.failures = 0
+	cb.consecutive = 0
+	cb.successes = 0
+	if state == StateOpen {
+		cb.openedAt = now
+	}
+}
+
+// allow returns the generation the call started in or *ErrCircuitOpen if the call is rejected
+func (cb *CircuitBreaker) allow(segment tracer.Segment) (int, error) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	now := cb.cfg.clock.Now()
+	switch cb.state {
+	case StateOpen:
+		retryAt := cb.openedAt.Add(cb.cfg.coolDown)
+		if now.Before(retryAt) {
+			return 0, &ErrCircuitOpen{Name: cb.name, RetryAt: retryAt}
+		}
+		cb.setState(segment, StateHalfOpen, now)
+		fallthrough
+
+	case StateHalfOpen:
+		if cb.inFlight >= cb.cfg.halfOpenRequests-cb.successes {
+			return 0, &ErrCircuitOpen{Name: cb.name, RetryAt: now.Add(cb.cfg.coolDown)}
+		}
+
+	default:
+		if cb.cfg.window > 0 && now.Sub(cb.windowStart) > cb.cfg.window {
+			cb.windowStart = now
+			cb.requests = 0
+			cb.failures = 0
+		}
+	}
+
+	cb.inFlight++
+	return cb.generation, nil
+}
+
+// record the result of a call that started in the generation provided; results of calls that
+// started before the last change of state are ignored e.g. a slow call that started while closed
+// is not mistaken for a half-open trial
+func (cb *CircuitBreaker) record(segment tracer.Segment, generation int, failed bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if generation != cb.generation {
+		return
+	}
+
+	now := cb.cfg.clock.Now()
+	cb.inFlight--
+
+	if cb.state == StateHalfOpen {
+		if failed {
+			cb.setState(segment, StateOpen, now)
+			return
+		}
+
+		cb.successes++
+		if cb.successes >= cb.cfg.halfOpenRequests {
+			cb.setState(segment, StateClosed, now)
+		}
+		return
+	}
+
+	if cb.state != StateClosed {
+		return
+	}
+
+	cb.requests++
+	if !failed {
+		cb.consecutive = 0
+		return
+	}
+
+	cb.failures++
+	cb.consecutive++
+
+	if n := cb.cfg.consecutiveFailures; n > 0 && cb.consecutive >= n {
+		cb.setState(segment, StateOpen, now)
+		return
+	}
+
+	if rate := cb.cfg.failureRate; rate > 0 && cb.requests >= cb.cfg.minRequests {
+		if float64(cb.failures)/float64(cb.requests) >= rate {
+			cb.setState(segment, StateOpen, now)
+		}
+	}
+}
+
+// Filter implements Filter; calls are rejected with *ErrCircuitOpen while the circuit is open
+func (cb *CircuitBreaker) Filter(a Action) Action {
+	return func(ctx context.Context) error {
+		segment := tracer.SegmentFromContext(ctx)
+
+		generation, err := cb.allow(segment)
+		if err != nil {
+			return err
+		}
+
+		err = a.Do(ctx)
+
+		failed := err != nil
+		if failed {
+			if cb.cfg.isFailure != nil {
+				failed = cb.cfg.isFailure(err)
+			} else if ctx.Err() != nil && err == ctx.Err() {
+				failed = false
+			}
+		}
+		cb.record(segment, generation, failed)
+
+		return err
+	}
+}
+
+// Breaker returns a Filter backed by a new CircuitBreaker
+func Breaker(name string, opts ...BreakerOption) Filter {
+	return NewCircuitBreaker(name, opts...).Filter
+}
@@ -0,0 +1,164 @@
+package action_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var failing = true
+	a := action.Action(func(ctx context.Context) error {
+		if failing {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+
+	cb := action.NewCircuitBreaker("test",
+		action.WithConsecutiveFailures(3),
+		action.WithCoolDown(time.Millisecond*50),
+	)
+	fn := a.Use(cb.Filter)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, io.ErrUnexpectedEOF, fn.Do(ctx))
+	}
+	assert.Equal(t, action.StateOpen, cb.State())
+
+	err := fn.Do(ctx)
+	assert.True(t, action.IsCircuitOpen(err))
+
+	time.Sleep(time.Millisecond * 75)
+	assert.Equal(t, action.StateHalfOpen, cb.State())
+
+	// failed trial re-opens the circuit
+	assert.Equal(t, io.ErrUnexpectedEOF, fn.Do(ctx))
+	assert.Equal(t, action.StateOpen, cb.State())
+
+	time.Sleep(time.Millisecond * 75)
+	failing = false
+	assert.Nil(t, fn.Do(ctx))
+	assert.Equal(t, action.StateClosed, cb.State())
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	calls := 0
+	a := action.Action(func(ctx context.Context) error {
+		calls++
+		if calls%2 == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+
+	cb := action.NewCircuitBreaker("rate",
+		action.WithConsecutiveFailures(0),
+		action.WithFailureRate(0.5, 10),
+		action.WithWindow(time.Minute),
+	)
+	fn := a.Use(cb.Filter)
+
+	for i := 0; i < 9; i++ {
+		fn.Do(ctx)
+	}
+	assert.Equal(t, action.StateClosed, cb.State())
+
+	fn.Do(ctx)
+	assert.Equal(t, action.StateOpen, cb.State())
+	assert.True(t, action.IsCircuitOpen(fn.Do(ctx)))
+	assert.Equal(t, 10, calls)
+}
+
+func TestCircuitBreakerIgnoresCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	a := action.Action(func(ctx context.Context) error {
+		return ctx.Err()
+	})
+
+	cb := action.NewCircuitBreaker("cancel", action.WithConsecutiveFailures(1))
+	assert.Equal(t, context.Canceled, a.Use(cb.Filter).Do(ctx))
+	assert.Equal(t, action.StateClosed, cb.State())
+}
+
+func TestCircuitBreakerClock(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := clock.NewFake(time.Now())
+	cb := action.NewCircuitBreaker("test",
+		action.WithConsecutiveFailures(1),
+		action.WithCoolDown(time.Hour),
+		action.WithClock(fake),
+	)
+	fn := action.Action(func(ctx context.Context) error { return io.ErrUnexpectedEOF }).Use(cb.Filter)
+
+	assert.Equal(t, io.ErrUnexpectedEOF, fn.Do(ctx))
+	assert.Equal(t, action.StateOpen, cb.State())
+
+	fake.Advance(time.Hour)
+	assert.Equal(t, action.StateHalfOpen, cb.State())
+}
+
+func TestCircuitBreakerIgnoresStaleResults(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := clock.NewFake(time.Now())
+	cb := action.NewCircuitBreaker("test",
+		action.WithConsecutiveFailures(1),
+		action.WithCoolDown(time.Minute),
+		action.WithClock(fake),
+	)
+
+	// blocked returns a call that waits for a result on the channel provided
+	blocked := func(result chan error) (started, done chan error) {
+		started, done = make(chan error, 1), make(chan error, 1)
+		fn := action.Action(func(ctx context.Context) error {
+			started <- nil
+			return <-result
+		}).Use(cb.Filter)
+
+		go func() { done <- fn.Do(ctx) }()
+		return started, done
+	}
+
+	// slow call starts while closed
+	slow := make(chan error)
+	started, slowDone := blocked(slow)
+	<-started
+
+	failing := action.Action(func(ctx context.Context) error { return io.ErrUnexpectedEOF }).Use(cb.Filter)
+	assert.Equal(t, io.ErrUnexpectedEOF, failing.Do(ctx))
+	assert.Equal(t, action.StateOpen, cb.State())
+
+	// trial call starts once half-open
+	fake.Advance(time.Minute)
+	trial := make(chan error)
+	started, trialDone := blocked(trial)
+	<-started
+
+	// the slow call succeeding must not be counted as the trial
+	slow <- nil
+	assert.Nil(t, <-slowDone)
+	assert.Equal(t, action.StateHalfOpen, cb.State())
+
+	trial <- io.ErrUnexpectedEOF
+	assert.Equal(t, io.ErrUnexpectedEOF, <-trialDone)
+	assert.Equal(t, action.StateOpen, cb.State())
+}
@@ -0,0 +1,49 @@
+package action
+
+import (
+	"github.com/altairsix/pkg/clock"
+)
+
+// ClockOption specifies the clock used to measure time.  It is accepted by every filter and action
+// in this package that measures time, alongside that filter's own options.
+type ClockOption interface {
+	SingletonOption
+	PartitionOption
+	DebounceOption
+	BackoffOption
+	BreakerOption
+	BulkheadOption
+	CronOption
+	SuperviseOption
+
+	clockValue() clock.Clock
+}
+
+type clockOption struct {
+	clock clock.Clock
+}
+
+func (o clockOption) clockValue() clock.Clock          { return clock.Or(o.clock) }
+func (o clockOption) applySingleton(s *singleton)      { s.clock = o.clockValue() }
+func (o clockOption) applyPartition(p *partition)      { p.clock = o.clockValue() }
+func (o clockOption) applyDebounce(d *debounceOptions) { d.clock = o.clockValue() }
+func (o clockOption) applyBackoff(b *backoff)          { b.clock = o.clockValue() }
+func (o clockOption) applyBreaker(b *breaker)          { b.clock = o.clockValue() }
+func (o clockOption) applyBulkhead(b *bulkhead)        { b.clock = o.clockValue() }
+func (o clockOption) applyCron(c *cron)                { c.clock = o.clockValue() }
+func (o clockOption) applySupervise(s *supervise)      { s.clock = o.clockValue() }
+
+// WithClock specifies the clock used to measure time; defaults to clock.System.  Use with
+// clock.Fake to control time in tests.
+func WithClock(c clock.Clock) ClockOption {
+	return clockOption{clock: c}
+}
+
+// clockOf returns the clock specified by the options provided or clock.System if none was
+func clockOf(opts []ClockOption) clock.Clock {
+	c := clock.System
+	for _, opt := range opts {
+		c = opt.clockValue()
+	}
+	return c
+}
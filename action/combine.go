@@ -0,0 +1,186 @@
+package action
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+)
+
+// Errors aggregates the errors returned by actions run concurrently
+type Errors []error
+
+// Error implements the error interface
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strconv.Itoa(len(e)) + " errors: " + strings.Join(messages, "; ")
+}
+
+// combine returns nil if there are no errors, the error itself if there's only one, otherwise Errors
+func combine(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return Errors(errs)
+	}
+}
+
+type result struct {
+	index int
+	err   error
+}
+
+// spawn runs the action in a goroutine within its own segment, delivering the result to ch
+func spawn(ctx context.Context, operationName string, index int, a Action, ch chan<- result) {
+	go func() {
+		segment, child := tracer.NewSegment(ctx, operationName, log.Int("index", index))
+		defer segment.Finish()
+
+		err := a.Do(child)
+		if err != nil {
+			segment.LogFields(log.Error(err))
+		}
+		ch <- result{index: index, err: err}
+	}()
+}
+
+// All runs the actions concurrently and waits for them to finish.  When an action fails, the
+// remaining actions are canceled.  Returns the error if a single action failed or Errors if several
+// did; errors caused by the cancellation itself are not reported.
+func All(actions ...Action) Action {
+	return func(ctx context.Context) error {
+		segment, ctx := tracer.NewSegment(ctx, "action:all", log.Int("actions", len(actions)))
+		defer segment.Finish()
+
+		child, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		ch := make(chan result, len(actions))
+		for i, a := range actions {
+			spawn(child, "action:all:child", i, a, ch)
+		}
+
+		var errs []error
+		for range actions {
+			r := <-ch
+			if r.err == nil {
+				continue
+			}
+			if len(errs) > 0 && errors.Cause(r.err) == context.Canceled {
+				continue
+			}
+
+			segment.Info("all:err", log.Int("index", r.index), log.Error(r.err))
+			errs = append(errs, r.err)
+			cancel()
+		}
+
+		return combine(errs)
+	}
+}
+
+// Race runs the actions concurrently; the first to succeed wins and the remaining actions are
+// canceled.  Returns Errors if every action fails.
+func Race(actions ...Action) Action {
+	return func(ctx context.Context) error {
+		segment, ctx := tracer.NewSegment(ctx, "action:race", log.Int("actions", len(actions)))
+		defer segment.Finish()
+
+		return race(ctx, segment, "action:race:child", actions, nil)
+	}
+}
+
+// race runs the actions, starting each one once the corresponding delay has elapsed or the
+// previous action has failed
+func race(ctx context.Context, segment tracer.Segment, operationName string, actions []Action, delay <-chan time.Time) error {
+	child, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan result, len(actions))
+	started, finished := 0, 0
+	start := func() {
+		spawn(child, operationName, started, actions[started], ch)
+		started++
+	}
+
+	if delay == nil {
+		for started < len(actions) {
+			start()
+		}
+	} else if len(actions) > 0 {
+		start()
+	}
+
+	var errs []error
+	for finished < started {
+		select {
+		case <-delay:
+			if started < len(actions) {
+				segment.Info("race:hedge", log.Int("index", started))
+				start()
+			}
+
+		case r := <-ch:
+			finished++
+			if r.err == nil {
+				segment.Info("race:won", log.Int("index", r.index))
+				return nil
+			}
+
+			errs = append(errs, r.err)
+			if started < len(actions) {
+				start() // don't wait for the delay when the attempt has already failed
+			}
+		}
+	}
+
+	return combine(errs)
+}
+
+// Sequence runs the actions one after another, stopping at the first error
+func Sequence(actions ...Action) Action {
+	return func(ctx context.Context) error {
+		segment, ctx := tracer.NewSegment(ctx, "action:sequence", log.Int("actions", len(actions)))
+		defer segment.Finish()
+
+		for i, a := range actions {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := a.Do(ctx); err != nil {
+				segment.Info("sequence:err", log.Int("index", i), log.Error(err))
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// Hedge runs the action and, if it has not completed within delay, starts a duplicate attempt.
+// The first attempt to succeed wins and the other is canceled.  Useful for reducing tail latency
+// on idempotent reads.
+func Hedge(delay time.Duration, a Action, opts ...ClockOption) Action {
+	clk := clockOf(opts)
+
+	return func(ctx context.Context) error {
+		segment, ctx := tracer.NewSegment(ctx, "action:hedge", log.Int64("delay-ms", int64(delay/time.Millisecond)))
+		defer segment.Finish()
+
+		timer := clk.NewTimer(delay)
+		defer timer.Stop()
+
+		return race(ctx, segment, "action:hedge:attempt", []Action{a, a}, timer.C())
+	}
+}
@@ -0,0 +1,122 @@
+package action_test
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func fail(err error) action.Action {
+	return func(ctx context.Context) error {
+		return err
+	}
+}
+
+func waitThen(d time.Duration, err error) action.Action {
+	return func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+			return err
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ok", func(t *testing.T) {
+		calls := int32(0)
+		err := action.All(Run(&calls), Run(&calls), Run(&calls)).Do(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(3), calls)
+	})
+
+	t.Run("cancels the rest", func(t *testing.T) {
+		startedAt := time.Now()
+		err := action.All(
+			fail(io.ErrUnexpectedEOF),
+			waitThen(time.Minute, nil),
+		).Do(ctx)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.True(t, time.Since(startedAt) < time.Second)
+	})
+
+	t.Run("aggregates errors", func(t *testing.T) {
+		err := action.All(fail(io.ErrUnexpectedEOF), fail(io.EOF)).Do(ctx)
+		errs, ok := err.(action.Errors)
+		assert.True(t, ok)
+		assert.ElementsMatch(t, action.Errors{io.ErrUnexpectedEOF, io.EOF}, errs)
+	})
+}
+
+func TestRace(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("first success wins", func(t *testing.T) {
+		startedAt := time.Now()
+		err := action.Race(
+			fail(io.ErrUnexpectedEOF),
+			waitThen(time.Minute, nil),
+			waitThen(time.Millisecond*10, nil),
+		).Do(ctx)
+		assert.Nil(t, err)
+		assert.True(t, time.Since(startedAt) < time.Second)
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		err := action.Race(fail(io.ErrUnexpectedEOF), fail(io.EOF)).Do(ctx)
+		assert.Len(t, err.(action.Errors), 2)
+	})
+}
+
+func TestSequence(t *testing.T) {
+	var order []int
+	step := func(i int, err error) action.Action {
+		return func(ctx context.Context) error {
+			order = append(order, i)
+			return err
+		}
+	}
+
+	err := action.Sequence(step(1, nil), step(2, io.EOF), step(3, nil)).Do(context.Background())
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []int{1, 2}, order)
+}
+
+func TestHedge(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	calls := int32(0)
+	a := func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done() // first attempt is slow
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- action.Hedge(time.Second, a, action.WithClock(fake)).Do(context.Background())
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+
+	assert.Nil(t, <-done)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	t.Run("fast", func(t *testing.T) {
+		calls := int32(0)
+		err := action.Hedge(time.Minute, Run(&calls)).Do(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1), calls)
+	})
+}
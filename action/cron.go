@@ -0,0 +1,404 @@
+package action
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/altairsix/pkg/clock"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+)
+
+// Schedule holds a parsed cron expression
+type Schedule struct {
+	spec                                  string
+	second, minute, hour, dom, month, dow uint64
+	hourRestricted                        bool
+	domRestricted, dowRestricted          bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondField = cronField{name: "second", min: 0, max: 59}
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day-of-month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid %v value, %v", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, errors.Errorf("%v value, %v, out of range [%v, %v]", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// parse returns the bitmask for the field along with whether the field was restricted i.e. not *
+func (f cronField) parse(expr string) (uint64, bool, error) {
+	var bits uint64
+	restricted := true
+
+	for _, term := range strings.Split(expr, ",") {
+		rangeExpr, step := term, 1
+		if i := strings.Index(term, "/"); i >= 0 {
+			v, err := strconv.Atoi(term[i+1:])
+			if err != nil || v <= 0 {
+				return 0, false, errors.Errorf("invalid %v step, %v", f.name, term)
+			}
+			rangeExpr, step = term[:i], v
+		}
+
+		var lo, hi int
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+			lo, hi = f.min, f.max
+			if step == 1 {
+				restricted = false
+			}
+
+		case strings.Contains(rangeExpr, "-"):
+			parts := strings.SplitN(rangeExpr, "-", 2)
+			v, err := f.value(parts[0])
+			if err != nil {
+				return 0, false, err
+			}
+			lo = v
+
+			if v, err = f.value(parts[1]); err != nil {
+				return 0, false, err
+			}
+			hi = v
+
+			if lo > hi {
+				return 0, false, errors.Errorf("invalid %v range, %v", f.name, rangeExpr)
+			}
+
+		default:
+			v, err := f.value(rangeExpr)
+			if err != nil {
+				return 0, false, err
+			}
+			lo, hi = v, v
+			if strings.Contains(term, "/") {
+				hi = f.max
+			}
+		}
+
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, restricted, nil
+}
+
+// ParseCron parses a standard 5 field (minute hour day-of-month month day-of-week) or
+// 6 field (second minute hour day-of-month month day-of-week) cron expression
+func ParseCron(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, errors.Errorf("cron expression must contain 5 or 6 fields, %v", spec)
+	}
+
+	s := &Schedule{spec: spec}
+
+	var err error
+	if s.second, _, err = secondField.parse(fields[0]); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse cron expression, %v", spec)
+	}
+	if s.minute, _, err = minuteField.parse(fields[1]); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse cron expression, %v", spec)
+	}
+	if s.hour, s.hourRestricted, err = hourField.parse(fields[2]); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse cron expression, %v", spec)
+	}
+	if s.dom, s.domRestricted, err = domField.parse(fields[3]); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse cron expression, %v", spec)
+	}
+	if s.month, _, err = monthField.parse(fields[4]); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse cron expression, %v", spec)
+	}
+	if s.dow, s.dowRestricted, err = dowField.parse(fields[5]); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse cron expression, %v", spec)
+	}
+
+	// 7 is an alias for sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	return s, nil
+}
+
+// String returns the original cron expression
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	// as with standard cron, when both day fields are restricted, either may match
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// startOfDay returns the first instant of the specified day in loc.  Values outside their usual
+// ranges are normalized as with time.Date.
+func startOfDay(year int, month time.Month, day int, loc *time.Location) time.Time {
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	t := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+	for t.Day() != date.Day() {
+		// midnight fell within a daylight saving gap and was normalized into the previous day
+		t = t.Add(time.Minute)
+	}
+	return t
+}
+
+// repeated returns true if the wall clock time of t already occurred earlier, as happens in the
+// hour that repeats when clocks fall back
+func repeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-3 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+
+	earlier := t.Add(-time.Duration(before-offset) * time.Second)
+	return earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute() && earlier.Second() == t.Second()
+}
+
+// Next returns the first time after t that matches the schedule, in t's location.  Returns
+// the zero time if no match exists within the next five years.
+//
+// Wall clock times skipped when clocks spring forward do not exist and are never matched.  When
+// clocks fall back, schedules with a restricted hour match only the first occurrence of the
+// repeated wall clock time while schedules with an unrestricted hour, *, continue to match as
+// time elapses.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+
+	yearLimit := t.Year() + 5
+
+	for t.Year() <= yearLimit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = startOfDay(t.Year(), t.Month()+1, 1, loc)
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = startOfDay(t.Year(), t.Month(), t.Day()+1, loc)
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			// advance in absolute time as local hours may be skipped or repeated
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second)
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+
+		if s.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+
+		if s.hourRestricted && repeated(t) {
+			t = t.Add(time.Second)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// Overlap specifies what the Cron filter does when a tick arrives while the previous run
+// is still executing
+type Overlap int
+
+const (
+	// OverlapSkip ignores the tick
+	OverlapSkip Overlap = iota
+
+	// OverlapQueue runs once more after the current run completes; multiple ticks are coalesced
+	OverlapQueue
+
+	// OverlapCancel cancels the current run and starts a new one
+	OverlapCancel
+)
+
+type cron struct {
+	clock   clock.Clock
+	overlap Overlap
+}
+
+// CronOption provides functional options to Cron
+type CronOption interface {
+	applyCron(*cron)
+}
+
+type cronFunc func(*cron)
+
+func (fn cronFunc) applyCron(v *cron) { fn(v) }
+
+// WithOverlap specifies the overlap policy, defaults to OverlapSkip
+func WithOverlap(o Overlap) CronOption {
+	return cronFunc(func(c *cron) {
+		c.overlap = o
+	})
+}
+
+// Cron runs the action at each tick of the cron expression, evaluated in the location
+// provided (time.Local if nil), until the context is canceled.  To ensure only a single
+// node in the cluster fires, place Cron inside Singleton e.g.
+//
+//	a.Use(action.Singleton(hb), action.Cron("0 0 2 * * *", epoch.PT))
+func Cron(spec string, loc *time.Location, opts ...CronOption) Filter {
+	cfg := &cron{
+		clock:   clock.System,
+		overlap: OverlapSkip,
+	}
+
+	for _, opt := range opts {
+		opt.applyCron(cfg)
+	}
+
+	if loc == nil {
+		loc = time.Local
+	}
+
+	schedule, parseErr := ParseCron(spec)
+
+	return func(a Action) Action {
+		return func(ctx context.Context) error {
+			if parseErr != nil {
+				return parseErr
+			}
+
+			segment, ctx := tracer.NewSegment(ctx, "action:cron", log.String("cron", spec), log.String("location", loc.String()))
+			defer segment.Finish()
+
+			var (
+				wg         = &sync.WaitGroup{}
+				mutex      = &sync.Mutex{}
+				running    = false
+				queued     = false
+				generation = 0
+				cancel     = func() {}
+			)
+			defer wg.Wait()
+
+			// start must be called while holding the mutex
+			var start func()
+			start = func() {
+				child, cancelChild := context.WithCancel(ctx)
+				generation++
+				running, cancel = true, cancelChild
+
+				wg.Add(1)
+				go func(gen int) {
+					defer wg.Done()
+					defer cancelChild()
+
+					if err := a.Do(child); err != nil {
+						segment.Info("cron:err", log.Error(err))
+					}
+
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					if gen != generation {
+						return // superseded by a later run
+					}
+					if queued && ctx.Err() == nil {
+						queued = false
+						start()
+						return
+					}
+					running = false
+				}(generation)
+			}
+
+			fire := func(at time.Time) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				if running {
+					switch cfg.overlap {
+					case OverlapQueue:
+						segment.Info("cron:queued", log.String("tick", at.String()))
+						queued = true
+						return
+					case OverlapCancel:
+						segment.Info("cron:cancel_previous", log.String("tick", at.String()))
+						cancel()
+					default:
+						segment.Info("cron:skipped", log.String("tick", at.String()))
+						return
+					}
+				}
+
+				segment.Info("cron:fire", log.String("tick", at.String()))
+				start()
+			}
+
+			for {
+				now := cfg.clock.Now().In(loc)
+				next := schedule.Next(now)
+				if next.IsZero() {
+					return errors.Errorf("cron expression never fires, %v", spec)
+				}
+
+				timer := cfg.clock.NewTimer(next.Sub(now))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					mutex.Lock()
+					cancel()
+					mutex.Unlock()
+					return nil
+				case <-timer.C():
+					fire(next)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package action_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/clock"
+	"github.com/altairsix/pkg/epoch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	testCases := map[string]struct {
+		Spec     string
+		From     time.Time
+		Expected time.Time
+	}{
+		"every 15 minutes": {
+			Spec:     "0 */15 * * * *",
+			From:     time.Date(2018, 1, 1, 10, 7, 3, 0, time.UTC),
+			Expected: time.Date(2018, 1, 1, 10, 15, 0, 0, time.UTC),
+		},
+		"5 field": {
+			Spec:     "30 2 * * *",
+			From:     time.Date(2018, 1, 1, 10, 7, 3, 0, time.UTC),
+			Expected: time.Date(2018, 1, 2, 2, 30, 0, 0, time.UTC),
+		},
+		"weekdays": {
+			Spec:     "0 9 * * mon-fri",
+			From:     time.Date(2018, 9, 1, 10, 0, 0, 0, time.UTC), // saturday
+			Expected: time.Date(2018, 9, 3, 9, 0, 0, 0, time.UTC),
+		},
+		"sunday as 7": {
+			Spec:     "0 0 * * 7",
+			From:     time.Date(2018, 9, 3, 10, 0, 0, 0, time.UTC), // monday
+			Expected: time.Date(2018, 9, 9, 0, 0, 0, 0, time.UTC),
+		},
+		"list and month names": {
+			Spec:     "0 0 1,15 feb,mar *",
+			From:     time.Date(2018, 2, 16, 0, 0, 0, 0, time.UTC),
+			Expected: time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"exact match is skipped": {
+			Spec:     "0 0 * * *",
+			From:     time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+			Expected: time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		"location": {
+			Spec:     "0 2 * * *",
+			From:     time.Date(2018, 1, 1, 0, 0, 0, 0, epoch.PT),
+			Expected: time.Date(2018, 1, 1, 2, 0, 0, 0, epoch.PT),
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			schedule, err := action.ParseCron(tc.Spec)
+			assert.Nil(t, err)
+			assert.True(t, tc.Expected.Equal(schedule.Next(tc.From)), "got %v", schedule.Next(tc.From))
+		})
+	}
+
+	for _, spec := range []string{"", "* * *", "60 * * * * *", "* * * 13 *", "*/0 * * * *", "5-1 * * * *"} {
+		_, err := action.ParseCron(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
+
+func TestParseCronDaylightSaving(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	assert.Nil(t, err)
+	havana, err := time.LoadLocation("America/Havana")
+	assert.Nil(t, err)
+
+	testCases := map[string]struct {
+		Spec     string
+		From     time.Time
+		Expected time.Time
+	}{
+		"spring forward skips the missing time": {
+			Spec:     "0 30 2 * * *",
+			From:     time.Date(2026, 3, 8, 0, 0, 0, 0, la),
+			Expected: time.Date(2026, 3, 9, 2, 30, 0, 0, la),
+		},
+		"spring forward hourly": {
+			Spec:     "0 0 * * * *",
+			From:     time.Date(2026, 3, 8, 1, 30, 0, 0, la),
+			Expected: time.Date(2026, 3, 8, 3, 0, 0, 0, la),
+		},
+		"spring forward at midnight": {
+			Spec:     "0 0 12 * * *",
+			From:     time.Date(2026, 3, 7, 13, 0, 0, 0, havana),
+			Expected: time.Date(2026, 3, 8, 12, 0, 0, 0, havana),
+		},
+		"fall back fires once": {
+			Spec:     "30 1 * * *",
+			From:     time.Date(2026, 11, 1, 8, 30, 0, 0, time.UTC).In(la), // 01:30 PDT
+			Expected: time.Date(2026, 11, 2, 1, 30, 0, 0, la),
+		},
+		"fall back unrestricted hour follows elapsed time": {
+			Spec:     "0 */30 * * * *",
+			From:     time.Date(2026, 11, 1, 8, 30, 0, 0, time.UTC).In(la), // 01:30 PDT
+			Expected: time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC),         // 01:00 PST
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			schedule, err := action.ParseCron(tc.Spec)
+			assert.Nil(t, err)
+
+			next := make(chan time.Time, 1)
+			go func() { next <- schedule.Next(tc.From) }()
+
+			select {
+			case got := <-next:
+				assert.True(t, tc.Expected.Equal(got), "got %v", got)
+			case <-time.After(time.Second * 5):
+				t.Fatalf("Next did not return")
+			}
+		})
+	}
+}
+
+func TestCron(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	calls := int32(0)
+	err := Run(&calls).Use(action.Cron("* * * * * *", epoch.PT)).Do(ctx)
+	assert.Nil(t, err)
+	assert.True(t, calls >= 2, "expected cron to fire every second")
+}
+
+func TestCronOverlap(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		Overlap action.Overlap
+		Check   func(started, canceled int32)
+	}{
+		"skip": {
+			Overlap: action.OverlapSkip,
+			Check: func(started, canceled int32) {
+				assert.Equal(t, int32(1), started)
+			},
+		},
+		"cancel": {
+			Overlap: action.OverlapCancel,
+			Check: func(started, canceled int32) {
+				assert.True(t, started >= 2)
+				assert.True(t, canceled >= 1)
+			},
+		},
+	}
+
+	for label, tc := range testCases {
+		tc := tc
+		t.Run(label, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+			defer cancel()
+
+			started, canceled := int32(0), int32(0)
+			a := action.Action(func(ctx context.Context) error {
+				atomic.AddInt32(&started, 1)
+				<-ctx.Done()
+				if ctx.Err() == context.Canceled {
+					atomic.AddInt32(&canceled, 1)
+				}
+				return nil
+			})
+
+			err := a.Use(action.Cron("* * * * * *", nil, action.WithOverlap(tc.Overlap))).Do(ctx)
+			assert.Nil(t, err)
+			tc.Check(atomic.LoadInt32(&started), atomic.LoadInt32(&canceled))
+		})
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	calls := int32(0)
+	err := Run(&calls).Use(action.Cron("junk", nil)).Do(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(0), calls)
+}
+
+func TestCronClock(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2018, time.January, 1, 0, 0, 30, 0, time.UTC))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fired := make(chan struct{}, 1)
+	a := func(ctx context.Context) error {
+		fired <- struct{}{}
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- action.Cron("0 * * * * *", time.UTC, action.WithClock(fake)).AndThen(a).Do(ctx)
+	}()
+
+	fake.BlockUntil(1)
+	select {
+	case <-fired:
+		t.Fatal("expected cron to wait for the next minute")
+	default:
+	}
+
+	fake.Advance(time.Second * 30)
+	<-fired
+
+	cancel()
+	assert.Nil(t, <-done)
+}
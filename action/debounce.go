@@ -0,0 +1,169 @@
+package action
+
+import (
+	"context"
+	"time"
+
+	"github.com/altairsix/pkg/clock"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// Edge determines when a Debouncer runs its action relative to a burst of triggers
+type Edge int
+
+const (
+	// EdgeTrailing runs the action once the burst has gone quiet
+	EdgeTrailing Edge = 1 << iota
+
+	// EdgeLeading runs the action on the first trigger of the burst
+	EdgeLeading
+)
+
+type debounceOptions struct {
+	clock   clock.Clock
+	edge    Edge
+	maxWait time.Duration
+}
+
+// DebounceOption provides functional options to NewDebouncer
+type DebounceOption interface {
+	applyDebounce(*debounceOptions)
+}
+
+type debounceFunc func(*debounceOptions)
+
+func (fn debounceFunc) applyDebounce(d *debounceOptions) { fn(d) }
+
+// WithEdge specifies when a Debouncer runs; edges may be combined e.g. EdgeLeading|EdgeTrailing
+// runs on the first trigger and once more at the end of the burst if further triggers arrived.
+// Defaults to EdgeTrailing.
+func WithEdge(edge Edge) DebounceOption {
+	return debounceFunc(func(d *debounceOptions) {
+		d.edge = edge
+	})
+}
+
+// WithMaxWait bounds how long a burst may last before it is ended; ensures the trailing run
+// happens even if triggers never go quiet.  Defaults to 0, unbounded.
+func WithMaxWait(d time.Duration) DebounceOption {
+	return debounceFunc(func(o *debounceOptions) {
+		o.maxWait = d
+	})
+}
+
+// Debouncer coalesces many triggers into a single run of an action.  A burst begins with the
+// first trigger and ends once no trigger has been received for the wait period, or the max wait
+// has elapsed.  Runs of the action never overlap; triggers received while the action is running
+// are coalesced into a single pending trigger.
+type Debouncer struct {
+	action  Action
+	wait    time.Duration
+	maxWait time.Duration
+	edge    Edge
+	clock   clock.Clock
+	trigger chan struct{}
+}
+
+// NewDebouncer returns a Debouncer that runs the action provided; call Run to start it
+//
+//	d := action.NewDebouncer(time.Millisecond*50, checkOnce, action.WithEdge(action.EdgeLeading|action.EdgeTrailing))
+//	go d.Run(ctx)
+//	...
+//	d.Trigger()
+func NewDebouncer(wait time.Duration, a Action, opts ...DebounceOption) *Debouncer {
+	cfg := &debounceOptions{
+		clock: clock.System,
+	}
+	for _, opt := range opts {
+		opt.applyDebounce(cfg)
+	}
+
+	edge := cfg.edge
+	if edge == 0 {
+		edge = EdgeTrailing
+	}
+
+	return &Debouncer{
+		action:  a,
+		wait:    wait,
+		maxWait: cfg.maxWait,
+		edge:    edge,
+		clock:   cfg.clock,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Trigger requests a run of the action; never blocks
+func (d *Debouncer) Trigger() {
+	select {
+	case d.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes triggers until the context is canceled; Run implements Action
+func (d *Debouncer) Run(ctx context.Context) error {
+	segment, ctx := tracer.NewSegment(ctx, "action:debounce", log.Int64("wait-ms", int64(d.wait/time.Millisecond)))
+	defer segment.Finish()
+
+	run := func(edge string) {
+		segment.Info("debounce:run", log.String("edge", edge))
+		if err := d.action.Do(ctx); err != nil {
+			segment.Info("debounce:err", log.Error(err))
+		}
+	}
+
+	var (
+		timer     clock.Timer
+		expired   <-chan time.Time
+		startedAt time.Time
+		pending   bool
+	)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-d.trigger:
+			now := d.clock.Now()
+			if expired == nil {
+				startedAt = now
+				if d.edge&EdgeLeading != 0 {
+					run("leading")
+					now = d.clock.Now()
+				} else {
+					pending = true
+				}
+			} else {
+				pending = true
+			}
+
+			deadline := now.Add(d.wait)
+			if d.maxWait > 0 {
+				if limit := startedAt.Add(d.maxWait); limit.Before(deadline) {
+					deadline = limit
+				}
+			}
+
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = d.clock.NewTimer(deadline.Sub(now))
+			expired = timer.C()
+
+		case <-expired:
+			timer, expired = nil, nil
+			if pending && d.edge&EdgeTrailing != 0 {
+				run("trailing")
+			}
+			pending = false
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package action_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebouncer(t *testing.T) {
+	testCases := map[string]struct {
+		Edge     action.Edge
+		MaxWait  time.Duration
+		Expected []time.Duration // offset of each run from the start
+	}{
+		"trailing": {
+			Edge:     action.EdgeTrailing,
+			Expected: []time.Duration{time.Second * 5},
+		},
+		"leading": {
+			Edge:     action.EdgeLeading,
+			Expected: []time.Duration{0},
+		},
+		"leading and trailing": {
+			Edge:     action.EdgeLeading | action.EdgeTrailing,
+			Expected: []time.Duration{0, time.Second * 5},
+		},
+		"max wait": {
+			Edge:     action.EdgeTrailing,
+			MaxWait:  time.Second * 3,
+			Expected: []time.Duration{time.Second * 3, time.Second * 5},
+		},
+	}
+
+	for label, tc := range testCases {
+		tc := tc
+		t.Run(label, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			startedAt := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+			fake := clock.NewFake(startedAt)
+
+			runs := make(chan time.Duration, 10)
+			d := action.NewDebouncer(time.Second*2, func(ctx context.Context) error {
+				runs <- fake.Since(startedAt)
+				return nil
+			}, action.WithEdge(tc.Edge), action.WithMaxWait(tc.MaxWait), action.WithClock(fake))
+
+			done := make(chan error, 1)
+			go func() {
+				done <- d.Run(ctx)
+			}()
+
+			// allow the Run loop to process the trigger or timer before moving on
+			settle := func() { time.Sleep(time.Millisecond * 10) }
+
+			// a burst of triggers, one per second, followed by quiet
+			for i := 0; i < 4; i++ {
+				d.Trigger()
+				settle()
+				fake.Advance(time.Second)
+				settle()
+			}
+			fake.Advance(time.Second)
+			settle()
+
+			cancel()
+			assert.Nil(t, <-done)
+
+			var actual []time.Duration
+			for len(runs) > 0 {
+				actual = append(actual, <-runs)
+			}
+			assert.Equal(t, tc.Expected, actual)
+		})
+	}
+}
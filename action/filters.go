@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/altairsix/pkg/clock"
 	"github.com/altairsix/pkg/timeofday"
 	"github.com/altairsix/pkg/tracer"
 	"github.com/opentracing/opentracing-go/log"
@@ -22,7 +23,9 @@ func StopAfter(d time.Duration) Filter {
 }
 
 // Retry failed retries up to the specified number of times
-func Retry(retries int, delay time.Duration) Filter {
+func Retry(retries int, delay time.Duration, opts ...ClockOption) Filter {
+	clk := clockOf(opts)
+
 	return func(a Action) Action {
 		return func(ctx context.Context) (err error) {
 			for attempt := 0; attempt <= retries; attempt++ {
@@ -33,7 +36,7 @@ func Retry(retries int, delay time.Duration) Filter {
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
-				case <-time.After(delay):
+				case <-clk.After(delay):
 				}
 			}
 			return err
@@ -42,7 +45,9 @@ func Retry(retries int, delay time.Duration) Filter {
 }
 
 // Forever repeats the target action forever until the context is canceled
-func Forever(delay time.Duration) Filter {
+func Forever(delay time.Duration, opts ...ClockOption) Filter {
+	clk := clockOf(opts)
+
 	return func(a Action) Action {
 		return func(ctx context.Context) error {
 			segment, child := tracer.NewSegment(ctx, "forever", log.Int64("delay-ms", int64(delay/time.Millisecond)))
@@ -56,7 +61,7 @@ func Forever(delay time.Duration) Filter {
 				select {
 				case <-ctx.Done():
 					return nil
-				case <-time.After(jitter(delay)):
+				case <-clk.After(jitter(delay)):
 				}
 			}
 		}
@@ -65,15 +70,17 @@ func Forever(delay time.Duration) Filter {
 
 // RestartBetween restarts the action after a delay as long as the time
 // is within the time range provided.  Only the hour, minute, and second
-func RestartBetween(from, to timeofday.Clock, delay time.Duration) Filter {
+func RestartBetween(from, to timeofday.Clock, delay time.Duration, opts ...ClockOption) Filter {
+	clk := clockOf(opts)
+
 	return func(a Action) Action {
 		runOnce := func(ctx context.Context, now time.Time) error {
-			maxAge := to.Today().Sub(time.Now())
+			maxAge := to.On(now).Sub(now)
 			if maxAge <= 0 {
 				return nil
 			}
 
-			child, cancel := context.WithTimeout(ctx, maxAge)
+			child, cancel := clock.WithTimeout(ctx, clk, maxAge)
 			defer cancel()
 
 			return a.Do(child)
@@ -81,7 +88,7 @@ func RestartBetween(from, to timeofday.Clock, delay time.Duration) Filter {
 
 		return func(ctx context.Context) error {
 			for {
-				now := time.Now()
+				now := clk.Now()
 				if from.GT(now) || to.LT(now) {
 					return nil
 				}
@@ -92,7 +99,7 @@ func RestartBetween(from, to timeofday.Clock, delay time.Duration) Filter {
 
 				select {
 				case <-ctx.Done():
-				case <-time.After(jitter(delay)):
+				case <-clk.After(jitter(delay)):
 				}
 			}
 		}
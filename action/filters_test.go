@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/clock"
 	"github.com/altairsix/pkg/timeofday"
 	"github.com/stretchr/testify/assert"
 )
@@ -54,23 +55,53 @@ func TestRestartBetween(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
 
-	interval := time.Millisecond * 25
-	now := time.Now()
-	later := now.Add(time.Second)
-	if later.Sub(now) <= interval*2 {
-		later = later.Add(time.Second)
-	}
+	now := time.Date(2018, 1, 1, 10, 0, 0, 0, time.Local)
+	fake := clock.NewFake(now)
 
 	from := timeofday.Time(now)
-	to := timeofday.Time(later)
-	restart := action.RestartBetween(from, to, interval)
+	to := timeofday.Time(now.Add(time.Second * 10))
+	restart := action.RestartBetween(from, to, time.Second, action.WithClock(fake))
 
-	calls := 0
-	fn := action.Action(func(ctx context.Context) error {
-		calls++
-		return nil
-	})
-	err := restart.AndThen(fn).Do(ctx)
-	assert.Nil(t, err)
-	assert.True(t, calls > 1, "expected a number of invocations")
+	calls := int32(0)
+	done := make(chan error, 1)
+	go func() {
+		done <- restart.AndThen(Run(&calls)).Do(ctx)
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			assert.Nil(t, err)
+			assert.True(t, atomic.LoadInt32(&calls) > 1, "expected a number of invocations")
+			assert.False(t, fake.Now().Before(to.On(now)))
+			return
+		case <-time.After(time.Millisecond):
+			fake.Advance(time.Second)
+		}
+	}
+}
+
+func TestRetryClock(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Now())
+	calls := int32(0)
+	a := func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return io.ErrUnexpectedEOF
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- action.Retry(2, time.Hour, action.WithClock(fake)).AndThen(a).Do(context.Background())
+	}()
+
+	for i := 1; i <= 3; i++ {
+		fake.BlockUntil(1)
+		assert.Equal(t, int32(i), atomic.LoadInt32(&calls))
+		fake.Advance(time.Hour)
+	}
+
+	assert.Equal(t, io.ErrUnexpectedEOF, <-done)
+	assert.Equal(t, int32(3), calls)
 }
@@ -0,0 +1,230 @@
+package heartbeat
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+)
+
+// MemoryOption provides functional options to Memory
+type MemoryOption func(*MemoryBus)
+
+// WithDelay delays the delivery of every tick by d
+func WithDelay(d time.Duration) MemoryOption {
+	return func(m *MemoryBus) {
+		m.delay = d
+	}
+}
+
+// WithDropRate randomly drops the fraction of ticks specified e.g. 0.1 drops 10% of ticks
+func WithDropRate(rate float64) MemoryOption {
+	return func(m *MemoryBus) {
+		m.dropRate = rate
+	}
+}
+
+// WithSeed seeds the random source used to drop ticks so that runs are repeatable
+func WithSeed(seed int64) MemoryOption {
+	return func(m *MemoryBus) {
+		m.random = rand.New(rand.NewSource(seed))
+	}
+}
+
+type subscriber struct {
+	node string
+	ctx  context.Context
+	ch   chan action.Tick
+}
+
+// MemoryBus simulates the network between many nodes within a single process.  Each node
+// obtains its own action.Heartbeat via Node.  Ticks published by a node are delivered to every
+// node, including itself, that shares its partition.
+type MemoryBus struct {
+	mutex       sync.Mutex
+	delay       time.Duration
+	dropRate    float64
+	random      *rand.Rand
+	partitions  map[string]int
+	muted       map[string]bool
+	subscribers []*subscriber
+	published   int
+	dropped     int
+}
+
+// Memory returns a new in-memory bus that many simulated nodes can share
+func Memory(opts ...MemoryOption) *MemoryBus {
+	m := &MemoryBus{
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		partitions: map[string]int{},
+		muted:      map[string]bool{},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Node returns the action.Heartbeat for the named node
+func (m *MemoryBus) Node(name string) action.Heartbeat {
+	return &memoryNode{
+		bus:  m,
+		name: name,
+	}
+}
+
+// Partition splits the network into the groups of nodes provided; nodes may only exchange
+// ticks with nodes in the same group.  Nodes not listed share a group of their own.
+func (m *MemoryBus) Partition(groups ...[]string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.partitions = map[string]int{}
+	for i, group := range groups {
+		for _, node := range group {
+			m.partitions[node] = i + 1
+		}
+	}
+}
+
+// Heal removes all partitions
+func (m *MemoryBus) Heal() {
+	m.Partition()
+}
+
+// Mute drops all ticks published by the named node
+func (m *MemoryBus) Mute(node string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.muted[node] = true
+}
+
+// Unmute resumes delivery of ticks published by the named node
+func (m *MemoryBus) Unmute(node string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.muted, node)
+}
+
+// SetDelay changes the delivery delay of subsequent ticks
+func (m *MemoryBus) SetDelay(d time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.delay = d
+}
+
+// SetDropRate changes the fraction of subsequent ticks that are randomly dropped
+func (m *MemoryBus) SetDropRate(rate float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.dropRate = rate
+}
+
+// Stats returns the number of ticks published and the number of deliveries dropped
+func (m *MemoryBus) Stats() (published, dropped int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.published, m.dropped
+}
+
+func (m *MemoryBus) subscribe(ctx context.Context, node string) *subscriber {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s := &subscriber{
+		node: node,
+		ctx:  ctx,
+		ch:   make(chan action.Tick, 64),
+	}
+	m.subscribers = append(m.subscribers, s)
+	return s
+}
+
+func (m *MemoryBus) unsubscribe(s *subscriber) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, v := range m.subscribers {
+		if v == s {
+			m.subscribers = append(m.subscribers[:i], m.subscribers[i+1:]...)
+			close(s.ch)
+			return
+		}
+	}
+}
+
+// deliver must be called while holding the mutex
+func (m *MemoryBus) deliver(s *subscriber, tick action.Tick) {
+	select {
+	case <-s.ctx.Done():
+	case s.ch <- tick:
+	default:
+		m.dropped++ // subscriber is not keeping up
+	}
+}
+
+func (m *MemoryBus) publish(from string, tick action.Tick) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.published++
+
+	for _, s := range m.subscribers {
+		if m.muted[from] || m.partitions[from] != m.partitions[s.node] {
+			m.dropped++
+			continue
+		}
+		if m.dropRate > 0 && m.random.Float64() < m.dropRate {
+			m.dropped++
+			continue
+		}
+
+		if m.delay <= 0 {
+			m.deliver(s, tick)
+			continue
+		}
+
+		s := s
+		time.AfterFunc(m.delay, func() {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+
+			for _, v := range m.subscribers {
+				if v == s {
+					m.deliver(s, tick)
+					return
+				}
+			}
+		})
+	}
+}
+
+type memoryNode struct {
+	bus  *MemoryBus
+	name string
+}
+
+func (n *memoryNode) Publish(tick action.Tick) error {
+	n.bus.publish(n.name, tick)
+	return nil
+}
+
+func (n *memoryNode) Receive(ctx context.Context) (<-chan action.Tick, error) {
+	s := n.bus.subscribe(ctx, n.name)
+
+	go func() {
+		<-ctx.Done()
+		n.bus.unsubscribe(s)
+	}()
+
+	return s.ch, nil
+}
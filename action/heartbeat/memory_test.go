@@ -0,0 +1,160 @@
+package heartbeat_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/action/heartbeat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := heartbeat.Memory()
+	a, b := bus.Node("a"), bus.Node("b")
+
+	chA, err := a.Receive(ctx)
+	assert.Nil(t, err)
+	chB, err := b.Receive(ctx)
+	assert.Nil(t, err)
+
+	tick := action.Tick{ID: "a", StartedAt: time.Now()}
+	assert.Nil(t, a.Publish(tick))
+	assert.Equal(t, tick, <-chA)
+	assert.Equal(t, tick, <-chB)
+
+	t.Run("partition", func(t *testing.T) {
+		bus.Partition([]string{"a"}, []string{"b"})
+		defer bus.Heal()
+
+		a.Publish(tick)
+		assert.Equal(t, tick, <-chA)
+		select {
+		case <-chB:
+			t.Error("expected tick to be blocked by partition")
+		case <-time.After(time.Millisecond * 10):
+		}
+	})
+
+	t.Run("mute", func(t *testing.T) {
+		bus.Mute("a")
+		defer bus.Unmute("a")
+
+		a.Publish(tick)
+		select {
+		case <-chB:
+			t.Error("expected tick to be dropped")
+		case <-time.After(time.Millisecond * 10):
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		bus.SetDelay(time.Millisecond * 50)
+		defer bus.SetDelay(0)
+
+		startedAt := time.Now()
+		a.Publish(tick)
+		<-chB
+		<-chA
+		assert.True(t, time.Since(startedAt) >= time.Millisecond*50)
+	})
+
+	t.Run("drop rate", func(t *testing.T) {
+		bus.SetDropRate(1)
+		defer bus.SetDropRate(0)
+
+		a.Publish(tick)
+		select {
+		case <-chB:
+			t.Error("expected tick to be dropped")
+		case <-time.After(time.Millisecond * 10):
+		}
+	})
+}
+
+func runSingleton(ctx context.Context, hb action.Heartbeat, running *int32) <-chan struct{} {
+	interval := time.Millisecond * 10
+	singleton := action.Singleton(hb,
+		action.WithInterval(interval),
+		action.WithElections(interval*5),
+		action.WithLease(interval*20),
+	)
+
+	a := action.Action(func(ctx context.Context) error {
+		atomic.AddInt32(running, 1)
+		defer atomic.AddInt32(running, -1)
+		<-ctx.Done()
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		singleton.AndThen(a).Do(ctx)
+	}()
+	return done
+}
+
+func TestMemorySplitBrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := heartbeat.Memory()
+	bus.Partition([]string{"a"}, []string{"b"})
+
+	runningA, runningB := int32(0), int32(0)
+	doneA := runSingleton(ctx, bus.Node("a"), &runningA)
+	time.Sleep(time.Millisecond * 5)
+	doneB := runSingleton(ctx, bus.Node("b"), &runningB)
+
+	// each side of the partition elects its own leader
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runningA))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runningB))
+
+	// once healed, the younger leader steps down
+	bus.Heal()
+	select {
+	case <-doneB:
+	case <-time.After(time.Second):
+		t.Fatal("expected younger leader to step down")
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&runningB))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runningA))
+
+	cancel()
+	<-doneA
+}
+
+func TestMemoryLeaderLoss(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := heartbeat.Memory(heartbeat.WithSeed(1))
+
+	ctxA, cancelA := context.WithCancel(ctx)
+	runningA, runningB := int32(0), int32(0)
+	doneA := runSingleton(ctxA, bus.Node("a"), &runningA)
+	time.Sleep(time.Millisecond * 5)
+
+	// b sees the older leader and stands down
+	doneB := runSingleton(ctx, bus.Node("b"), &runningB)
+	<-doneB
+	assert.Equal(t, int32(0), atomic.LoadInt32(&runningB))
+
+	// leader goes away; the next election picks a new leader
+	cancelA()
+	<-doneA
+
+	doneB = runSingleton(ctx, bus.Node("b"), &runningB)
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runningB))
+
+	cancel()
+	<-doneB
+}
@@ -0,0 +1,193 @@
+package heartbeat
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/dbase"
+	"github.com/altairsix/pkg/epoch"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MySQLTableName is the default name of the heartbeat table
+	MySQLTableName = "heartbeat"
+
+	// CreateMySQLSQL provides sql to create the heartbeat table
+	CreateMySQLSQL = `
+	CREATE TABLE IF NOT EXISTS ${TABLE} (
+		name       VARCHAR(255) NOT NULL,
+		id         VARCHAR(64)  NOT NULL,
+		started_at BIGINT       NOT NULL,
+		updated_at BIGINT       NOT NULL,
+		PRIMARY KEY (name, id),
+		INDEX idx_${TABLE}_updated_at (name, updated_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+`
+
+	publishSQL = `
+	INSERT INTO ${TABLE} (name, id, started_at, updated_at) VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE started_at = VALUES(started_at), updated_at = VALUES(updated_at)
+`
+
+	expireSQL = `DELETE FROM ${TABLE} WHERE name = ? AND updated_at < ?`
+
+	pollSQL = `SELECT id, started_at, updated_at FROM ${TABLE} WHERE name = ?`
+)
+
+func expand(template, tableName string) string {
+	return strings.Replace(template, `${TABLE}`, tableName, -1)
+}
+
+// CreateMySQLTable creates the heartbeat table if it does not already exist
+func CreateMySQLTable(accessor dbase.Accessor, tableName string) error {
+	return accessor.Tx(context.Background(), func(ctx context.Context, db *gorm.DB) error {
+		if err := db.Exec(expand(CreateMySQLSQL, tableName)).Error; err != nil {
+			return errors.Wrapf(err, "unable to create heartbeat table, %v", tableName)
+		}
+		return nil
+	})
+}
+
+// MySQLOption provides functional options to MySQL
+type MySQLOption func(*mysqlHeartbeat)
+
+// WithTableName specifies the heartbeat table; defaults to MySQLTableName
+func WithTableName(tableName string) MySQLOption {
+	return func(m *mysqlHeartbeat) {
+		m.tableName = tableName
+	}
+}
+
+// WithPollInterval specifies how often the table is polled for ticks; defaults to 1s
+func WithPollInterval(d time.Duration) MySQLOption {
+	return func(m *mysqlHeartbeat) {
+		m.interval = d
+	}
+}
+
+// WithExpiration specifies how long rows may go without an update before they are removed;
+// defaults to 1m.  Should be longer than the Singleton lease.
+func WithExpiration(d time.Duration) MySQLOption {
+	return func(m *mysqlHeartbeat) {
+		m.expiration = d
+	}
+}
+
+type mysqlHeartbeat struct {
+	accessor   dbase.Accessor
+	name       string
+	tableName  string
+	interval   time.Duration
+	expiration time.Duration
+}
+
+func (m *mysqlHeartbeat) Publish(tick action.Tick) error {
+	return m.accessor.Tx(context.Background(), func(ctx context.Context, db *gorm.DB) error {
+		err := db.Exec(expand(publishSQL, m.tableName), m.name, tick.ID, epoch.Time(tick.StartedAt), epoch.Now()).Error
+		if err != nil {
+			return errors.Wrapf(err, "unable to publish heartbeat, %v", m.name)
+		}
+		return nil
+	})
+}
+
+type row struct {
+	ID        string
+	StartedAt epoch.Millis
+	UpdatedAt epoch.Millis
+}
+
+func (m *mysqlHeartbeat) poll() ([]row, error) {
+	var rows []row
+	err := m.accessor.Tx(context.Background(), func(ctx context.Context, db *gorm.DB) error {
+		cutoff := epoch.Now().Add(-m.expiration)
+		if err := db.Exec(expand(expireSQL, m.tableName), m.name, cutoff).Error; err != nil {
+			return errors.Wrapf(err, "unable to expire heartbeats, %v", m.name)
+		}
+
+		results, err := db.Raw(expand(pollSQL, m.tableName), m.name).Rows()
+		if err != nil {
+			return errors.Wrapf(err, "unable to poll heartbeats, %v", m.name)
+		}
+		defer results.Close()
+
+		for results.Next() {
+			r := row{}
+			if err := results.Scan(&r.ID, &r.StartedAt, &r.UpdatedAt); err != nil {
+				return errors.Wrapf(err, "unable to scan heartbeat, %v", m.name)
+			}
+			rows = append(rows, r)
+		}
+		return results.Err()
+	})
+	return rows, err
+}
+
+// Receive polls the heartbeat table and delivers a Tick each time a row is updated
+func (m *mysqlHeartbeat) Receive(ctx context.Context) (<-chan action.Tick, error) {
+	ch := make(chan action.Tick, 16)
+
+	go func() {
+		defer close(ch)
+
+		t := time.NewTicker(m.interval)
+		defer t.Stop()
+
+		seen := map[string]epoch.Millis{}
+		for {
+			rows, err := m.poll()
+			if err == nil {
+				ids := make(map[string]struct{}, len(rows))
+				for _, r := range rows {
+					ids[r.ID] = struct{}{}
+					if seen[r.ID] == r.UpdatedAt {
+						continue
+					}
+					seen[r.ID] = r.UpdatedAt
+
+					select {
+					case <-ctx.Done():
+						return
+					case ch <- action.Tick{ID: r.ID, StartedAt: r.StartedAt.Time()}:
+					}
+				}
+				for id := range seen {
+					if _, ok := ids[id]; !ok {
+						delete(seen, id)
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// MySQL returns a Heartbeat that publishes ticks to a MySQL table and polls the table to receive
+// them; name distinguishes heartbeats sharing the table.  Use CreateMySQLTable or CreateMySQLSQL
+// to create the table.
+func MySQL(accessor dbase.Accessor, name string, opts ...MySQLOption) action.Heartbeat {
+	m := &mysqlHeartbeat{
+		accessor:   accessor,
+		name:       name,
+		tableName:  MySQLTableName,
+		interval:   time.Second,
+		expiration: time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
@@ -0,0 +1,45 @@
+package heartbeat_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/action/heartbeat"
+	"github.com/altairsix/pkg/dbase"
+	"github.com/altairsix/pkg/dbase/dbtest"
+	"github.com/savaki/randx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQL(t *testing.T) {
+	accessor := dbase.OpenFunc(dbtest.Open)
+	tableName := "heartbeat_" + randx.AlphaN(8)
+
+	err := heartbeat.CreateMySQLTable(accessor, tableName)
+	assert.Nil(t, err)
+
+	tk := heartbeat.MySQL(accessor, randx.AlphaN(12),
+		heartbeat.WithTableName(tableName),
+		heartbeat.WithPollInterval(time.Millisecond*50),
+	)
+
+	tick := action.Tick{
+		ID:        randx.AlphaN(12),
+		StartedAt: time.Now().Truncate(time.Millisecond),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := tk.Receive(ctx)
+	assert.Nil(t, err)
+
+	err = tk.Publish(tick)
+	assert.Nil(t, err)
+
+	actual := <-ch
+	assert.Equal(t, tick.ID, actual.ID)
+	assert.True(t, tick.StartedAt.Equal(actual.StartedAt))
+}
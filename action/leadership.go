@@ -0,0 +1,110 @@
+package action
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Role identifies the part a Singleton instance currently plays in the cluster
+type Role int
+
+const (
+	// RoleCandidate indicates the instance is waiting for the election to complete
+	RoleCandidate Role = iota
+
+	// RoleLeader indicates the instance is running the action
+	RoleLeader
+
+	// RoleFollower indicates the instance deferred to an older instance
+	RoleFollower
+)
+
+// String renders the Role as a string
+func (r Role) String() string {
+	switch r {
+	case RoleCandidate:
+		return "candidate"
+	case RoleLeader:
+		return "leader"
+	case RoleFollower:
+		return "follower"
+	default:
+		return "unknown:" + strconv.Itoa(int(r))
+	}
+}
+
+// MarshalText allows Role to be rendered as a string in json
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// LeadershipStatus describes the state of a Singleton at a point in time
+type LeadershipStatus struct {
+	// Role of this instance
+	Role Role `json:"role"`
+
+	// ID of this instance
+	ID string `json:"id,omitempty"`
+
+	// StartedAt is when this instance started
+	StartedAt time.Time `json:"started_at"`
+
+	// LeaderID is the tick ID of the current leader, if known
+	LeaderID string `json:"leader_id,omitempty"`
+
+	// LeaderStartedAt is when the current leader started, if known
+	LeaderStartedAt time.Time `json:"leader_started_at"`
+
+	// UpdatedAt is when the status last changed
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsLeader returns true if this instance is the leader
+func (s LeadershipStatus) IsLeader() bool {
+	return s.Role == RoleLeader
+}
+
+// LeadershipFunc receives notification of changes in leadership.  Callbacks are invoked from
+// the Singleton election loop and should not block.
+type LeadershipFunc func(ctx context.Context, status LeadershipStatus)
+
+// Leadership provides a thread safe view of the role of a Singleton; suitable for
+// health checks.  A single Leadership may be shared across restarts of the Singleton.
+type Leadership struct {
+	mutex  sync.Mutex
+	status LeadershipStatus
+}
+
+// NewLeadership returns a new Leadership in the candidate role
+func NewLeadership() *Leadership {
+	return &Leadership{
+		status: LeadershipStatus{
+			Role:      RoleCandidate,
+			UpdatedAt: time.Now(),
+		},
+	}
+}
+
+// Status returns the current status
+func (l *Leadership) Status() LeadershipStatus {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.status
+}
+
+func (l *Leadership) set(role Role, self, leader Tick) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.status = LeadershipStatus{
+		Role:            role,
+		ID:              self.ID,
+		StartedAt:       self.StartedAt,
+		LeaderID:        leader.ID,
+		LeaderStartedAt: leader.StartedAt,
+		UpdatedAt:       time.Now(),
+	}
+}
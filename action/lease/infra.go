@@ -0,0 +1,58 @@
+package lease
+
+import (
+	"fmt"
+
+	"github.com/altairsix/pkg/fq"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+// TableName provides name of the leases table for a given environment
+func TableName(env string) string {
+	return fq.SingletonTableName(env)
+}
+
+// MakeCreateTableInput creates the create table description
+func MakeCreateTableInput(env string, readCapacity, writeCapacity int64) *dynamodb.CreateTableInput {
+	return &dynamodb.CreateTableInput{
+		TableName: aws.String(TableName(env)),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String(keyAttribute),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String(keyAttribute),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(readCapacity),
+			WriteCapacityUnits: aws.Int64(writeCapacity),
+		},
+	}
+}
+
+// CreateTable creates tables with specified capacity
+func CreateTable(api *dynamodb.DynamoDB, env string, readCapacity, writeCapacity int64) error {
+	tableName := TableName(env)
+	fmt.Printf("creating table, %v ... ", tableName)
+
+	input := MakeCreateTableInput(env, readCapacity, writeCapacity)
+	_, err := api.CreateTable(input)
+	if err != nil {
+		if v, ok := err.(awserr.Error); ok && v.Code() == dynamodb.ErrCodeResourceInUseException {
+			fmt.Println("already exists, skipping")
+			return nil
+		}
+		return errors.Wrapf(err, "unable to create table, %v", tableName)
+	}
+
+	fmt.Println("ok")
+	return nil
+}
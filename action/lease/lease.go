@@ -0,0 +1,278 @@
+package lease
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	keyAttribute       = "key"
+	ownerAttribute     = "owner"
+	tokenAttribute     = "token"
+	expiresAttribute   = "expires"
+	startedAtAttribute = "started_at"
+)
+
+type contextKey struct{}
+
+// Token returns the fencing token of the lease held by the current leader.  Tokens increase
+// monotonically each time the lease changes hands so downstream systems can reject writes
+// from a leader whose lease has since been taken over.
+func Token(ctx context.Context) (int64, bool) {
+	v, ok := ctx.Value(contextKey{}).(int64)
+	return v, ok
+}
+
+// WithToken returns a child context that holds the fencing token provided
+func WithToken(ctx context.Context, token int64) context.Context {
+	return context.WithValue(ctx, contextKey{}, token)
+}
+
+type config struct {
+	lease    time.Duration
+	renew    time.Duration
+	interval time.Duration
+}
+
+// Option provides functional options to Singleton
+type Option func(*config)
+
+// WithLease specifies how long a lease remains valid without renewal
+func WithLease(d time.Duration) Option {
+	return func(c *config) {
+		c.lease = d
+	}
+}
+
+// WithRenew specifies how frequently the leader renews its lease; should be well under the lease
+func WithRenew(d time.Duration) Option {
+	return func(c *config) {
+		c.renew = d
+	}
+}
+
+// WithInterval specifies how frequently followers attempt to acquire the lease
+func WithInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.interval = d
+	}
+}
+
+// lock manages a single named lease within the dynamodb singleton table
+type lock struct {
+	api       *dynamodb.DynamoDB
+	tableName string
+	name      string
+	owner     string
+	startedAt time.Time
+	cfg       *config
+}
+
+func millis(t time.Time) *string {
+	return aws.String(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10))
+}
+
+func isConditionFailed(err error) bool {
+	v, ok := err.(awserr.Error)
+	return ok && v.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
+
+// acquire attempts to take ownership of the lease and returns the new fencing token.  ok will be
+// false if the lease is currently held by another owner.
+func (l *lock) acquire(now time.Time) (token int64, ok bool, err error) {
+	out, err := l.api.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(l.tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			keyAttribute: {S: aws.String(l.name)},
+		},
+		UpdateExpression:    aws.String("SET #owner = :owner, #expires = :expires, #started_at = :started_at ADD #token :one"),
+		ConditionExpression: aws.String("attribute_not_exists(#key) OR #expires < :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#key":        aws.String(keyAttribute),
+			"#owner":      aws.String(ownerAttribute),
+			"#token":      aws.String(tokenAttribute),
+			"#expires":    aws.String(expiresAttribute),
+			"#started_at": aws.String(startedAtAttribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner":      {S: aws.String(l.owner)},
+			":expires":    {N: millis(now.Add(l.cfg.lease))},
+			":started_at": {N: millis(l.startedAt)},
+			":now":        {N: millis(now)},
+			":one":        {N: aws.String("1")},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
+	})
+	if err != nil {
+		if isConditionFailed(err) {
+			return 0, false, nil
+		}
+		return 0, false, errors.Wrapf(err, "unable to acquire lease, %v", l.name)
+	}
+
+	v := out.Attributes[tokenAttribute]
+	if v == nil || v.N == nil {
+		return 0, false, errors.Errorf("lease, %v, returned no fencing token", l.name)
+	}
+
+	token, err = strconv.ParseInt(*v.N, 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "unable to parse fencing token for lease, %v", l.name)
+	}
+
+	return token, true, nil
+}
+
+// renew extends the lease provided it is still held with the token provided
+func (l *lock) renew(now time.Time, token int64) error {
+	_, err := l.api.UpdateItem(l.ownedUpdate(token, now.Add(l.cfg.lease)))
+	if err != nil {
+		return errors.Wrapf(err, "unable to renew lease, %v", l.name)
+	}
+	return nil
+}
+
+// release expires the lease immediately so that another node may acquire it
+func (l *lock) release(token int64) error {
+	_, err := l.api.UpdateItem(l.ownedUpdate(token, time.Unix(0, 0)))
+	if err != nil && !isConditionFailed(err) {
+		return errors.Wrapf(err, "unable to release lease, %v", l.name)
+	}
+	return nil
+}
+
+func (l *lock) ownedUpdate(token int64, expires time.Time) *dynamodb.UpdateItemInput {
+	return &dynamodb.UpdateItemInput{
+		TableName: aws.String(l.tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			keyAttribute: {S: aws.String(l.name)},
+		},
+		UpdateExpression:    aws.String("SET #expires = :expires"),
+		ConditionExpression: aws.String("#owner = :owner AND #token = :token"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner":   aws.String(ownerAttribute),
+			"#token":   aws.String(tokenAttribute),
+			"#expires": aws.String(expiresAttribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner":   {S: aws.String(l.owner)},
+			":token":   {N: aws.String(strconv.FormatInt(token, 10))},
+			":expires": {N: millis(expires)},
+		},
+	}
+}
+
+// lead runs the action while the lease is held.  Returns when the action completes or the
+// lease could not be renewed.
+func (l *lock) lead(ctx context.Context, segment tracer.Segment, a action.Action, token int64, acquiredAt time.Time) error {
+	child, cancel := context.WithCancel(WithToken(ctx, token))
+	defer cancel()
+
+	finished := make(chan error, 1)
+	go func() {
+		childSegment, child := tracer.NewSegment(child, "lease:run:finished", log.Int64("token", token))
+		childSegment.Info("lease:run:started")
+		defer childSegment.Finish()
+
+		finished <- a.Do(child)
+	}()
+
+	t := time.NewTicker(l.cfg.renew)
+	defer t.Stop()
+
+	expires := acquiredAt.Add(l.cfg.lease)
+	for {
+		select {
+		case err := <-finished:
+			if releaseErr := l.release(token); releaseErr != nil {
+				segment.LogFields(log.Error(releaseErr))
+			}
+			if err != nil {
+				segment.LogFields(log.Error(err))
+			}
+			return err
+
+		case <-t.C:
+			now := time.Now()
+			err := l.renew(now, token)
+			if err == nil {
+				expires = now.Add(l.cfg.lease)
+				continue
+			}
+
+			// give up once the lease would lapse before the next renewal attempt
+			segment.Info("lease:renew_failed", log.Int64("token", token), log.Error(err))
+			if isConditionFailed(errors.Cause(err)) || !time.Now().Add(l.cfg.renew).Before(expires) {
+				segment.Info("lease:lost_leadership", log.Int64("token", token))
+				cancel()
+				<-finished
+				return nil
+			}
+		}
+	}
+}
+
+// Singleton ensures that only a single instance of the action runs across all nodes sharing
+// the same dynamodb singleton table and name.  Unlike the Heartbeat based action.Singleton,
+// leadership is decided by a conditional write so at most one node holds the lease at a time.
+// The fencing token for the current lease is available to the action via Token.
+//
+// Leases rely on the clocks of the competing nodes being roughly in sync; the lease duration
+// should comfortably exceed any expected clock skew.
+func Singleton(api *dynamodb.DynamoDB, env, name string, opts ...Option) action.Filter {
+	cfg := &config{
+		lease:    time.Second * 30,
+		renew:    time.Second * 10,
+		interval: time.Second * 5,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(a action.Action) action.Action {
+		return func(ctx context.Context) error {
+			l := &lock{
+				api:       api,
+				tableName: TableName(env),
+				name:      name,
+				owner:     ksuid.New().String(),
+				startedAt: time.Now(),
+				cfg:       cfg,
+			}
+
+			segment, ctx := tracer.NewSegment(ctx, "action:lease", log.String("lease", name))
+			segment.SetBaggageItem("lease-owner", l.owner)
+			defer segment.Finish()
+
+			for {
+				now := time.Now()
+				token, ok, err := l.acquire(now)
+				if err != nil {
+					segment.LogFields(log.Error(err))
+				}
+				if ok {
+					segment.Info("lease:elected_leader", log.Int64("token", token))
+					return l.lead(ctx, segment, a, token, now)
+				}
+
+				select {
+				case <-ctx.Done():
+					segment.Info("lease:canceled")
+					return nil
+				case <-time.After(cfg.interval):
+				}
+			}
+		}
+	}
+}
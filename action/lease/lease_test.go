@@ -0,0 +1,71 @@
+package lease_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/action/lease"
+	"github.com/altairsix/pkg/local"
+	"github.com/savaki/randx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	_, ok := lease.Token(context.Background())
+	assert.False(t, ok)
+
+	token, ok := lease.Token(lease.WithToken(context.Background(), 123))
+	assert.True(t, ok)
+	assert.Equal(t, int64(123), token)
+}
+
+func TestSingleton(t *testing.T) {
+	err := lease.CreateTable(local.DynamoDB, local.Env, 5, 5)
+	assert.Nil(t, err)
+
+	name := randx.AlphaN(12)
+	singleton := lease.Singleton(local.DynamoDB, local.Env, name,
+		lease.WithLease(time.Second),
+		lease.WithRenew(time.Millisecond*250),
+		lease.WithInterval(time.Millisecond*50),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	running := int32(0)
+	leaders := int32(0)
+	tokens := make(chan int64, 4)
+	a := action.Action(func(ctx context.Context) error {
+		assert.Equal(t, int32(1), atomic.AddInt32(&running, 1), "expected only one leader at a time")
+		defer atomic.AddInt32(&running, -1)
+
+		atomic.AddInt32(&leaders, 1)
+		token, ok := lease.Token(ctx)
+		assert.True(t, ok)
+		tokens <- token
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Millisecond * 500):
+		}
+		return nil
+	})
+
+	done := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			singleton.AndThen(a).Do(ctx)
+		}()
+	}
+	<-done
+	<-done
+
+	assert.Equal(t, int32(2), leaders)
+	first, second := <-tokens, <-tokens
+	assert.True(t, second > first, "expected fencing tokens to increase")
+}
@@ -0,0 +1,191 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/altairsix/pkg/clock"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrBulkheadFull is returned when the Bulkhead queue has no more room for waiting callers
+	ErrBulkheadFull = errors.New("bulkhead full")
+)
+
+type bulkhead struct {
+	clock      clock.Clock
+	queueDepth int
+}
+
+// BulkheadOption provides functional options to Bulkhead
+type BulkheadOption interface {
+	applyBulkhead(*bulkhead)
+}
+
+type bulkheadFunc func(*bulkhead)
+
+func (fn bulkheadFunc) applyBulkhead(v *bulkhead) { fn(v) }
+
+// WithQueueDepth limits the number of callers that may wait for a slot; callers beyond
+// the limit are rejected with ErrBulkheadFull.  By default, callers wait without limit.
+func WithQueueDepth(n int) BulkheadOption {
+	return bulkheadFunc(func(b *bulkhead) {
+		b.queueDepth = n
+	})
+}
+
+// Bulkhead limits the number of concurrent executions of the action to n.  Callers wait
+// for a free slot until their context is canceled.  Panics if n is not positive.
+func Bulkhead(n int, opts ...BulkheadOption) Filter {
+	if n <= 0 {
+		panic(fmt.Sprintf("action: Bulkhead requires at least one slot; got %v", n))
+	}
+
+	cfg := &bulkhead{
+		clock:      clock.System,
+		queueDepth: -1,
+	}
+
+	for _, opt := range opts {
+		opt.applyBulkhead(cfg)
+	}
+
+	slots := make(chan struct{}, n)
+	mutex := sync.Mutex{}
+	waiting := 0
+
+	return func(a Action) Action {
+		return func(ctx context.Context) error {
+			segment := tracer.SegmentFromContext(ctx)
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				return a.Do(ctx)
+			default:
+			}
+
+			mutex.Lock()
+			if cfg.queueDepth >= 0 && waiting >= cfg.queueDepth {
+				mutex.Unlock()
+				segment.Info("bulkhead:full", log.Int("waiting", waiting))
+				return ErrBulkheadFull
+			}
+			waiting++
+			mutex.Unlock()
+
+			startedAt := cfg.clock.Now()
+			select {
+			case slots <- struct{}{}:
+				mutex.Lock()
+				waiting--
+				mutex.Unlock()
+
+			case <-ctx.Done():
+				mutex.Lock()
+				waiting--
+				mutex.Unlock()
+				return ctx.Err()
+			}
+			defer func() { <-slots }()
+
+			segment.Info("bulkhead:acquired", log.Int64("wait-ms", int64(cfg.clock.Since(startedAt)/time.Millisecond)))
+			return a.Do(ctx)
+		}
+	}
+}
+
+// tokenBucket provides a thread safe token bucket
+type tokenBucket struct {
+	mutex    sync.Mutex
+	interval time.Duration // time to refill a single token
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// reserve takes a token from the bucket and returns how long the caller must wait before
+// the token becomes valid
+func (t *tokenBucket) reserve(now time.Time) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if elapsed := now.Sub(t.last); elapsed > 0 {
+		t.tokens += float64(elapsed) / float64(t.interval)
+		if t.tokens > t.burst {
+			t.tokens = t.burst
+		}
+		t.last = now
+	}
+
+	t.tokens--
+	if t.tokens >= 0 {
+		return 0
+	}
+	if wait := -t.tokens * float64(t.interval); wait < math.MaxInt64 {
+		return time.Duration(wait)
+	}
+	return time.Duration(math.MaxInt64)
+}
+
+// cancel returns an unused token to the bucket
+func (t *tokenBucket) cancel() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.tokens++
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+}
+
+// RateLimit limits the rate at which the action may be started to rate per second, with
+// up to burst starts allowed at once.  Callers wait for a token until their context is
+// canceled.  Panics if rate is not positive or so small that a single token takes longer than
+// the maximum time.Duration to refill.
+func RateLimit(rate float64, burst int, opts ...ClockOption) Filter {
+	clk := clockOf(opts)
+
+	interval := float64(time.Second) / rate
+	if !(rate > 0) || interval >= math.MaxInt64 {
+		panic(fmt.Sprintf("action: RateLimit requires a positive rate that refills within %v; got %v", time.Duration(math.MaxInt64), rate))
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	bucket := &tokenBucket{
+		interval: time.Duration(interval),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     clk.Now(),
+	}
+
+	return func(a Action) Action {
+		return func(ctx context.Context) error {
+			if delay := bucket.reserve(clk.Now()); delay > 0 {
+				segment := tracer.SegmentFromContext(ctx)
+
+				timer := clk.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					bucket.cancel()
+					return ctx.Err()
+				case <-timer.C():
+				}
+
+				segment.Info("rate_limit:acquired", log.Int64("wait-ms", int64(delay/time.Millisecond)))
+			}
+
+			return a.Do(ctx)
+		}
+	}
+}
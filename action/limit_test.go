@@ -0,0 +1,130 @@
+package action_test
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkhead(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	active := int32(0)
+	max := int32(0)
+	a := action.Action(func(ctx context.Context) error {
+		v := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			current := atomic.LoadInt32(&max)
+			if v <= current || atomic.CompareAndSwapInt32(&max, current, v) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+		return nil
+	})
+
+	fn := a.Use(action.Bulkhead(2))
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, fn.Do(ctx))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), max)
+}
+
+func TestBulkheadQueueDepth(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	a := action.Action(func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	fn := a.Use(action.Bulkhead(1, action.WithQueueDepth(1)))
+
+	go fn.Do(ctx) // occupies the slot
+	time.Sleep(time.Millisecond * 10)
+	go fn.Do(ctx) // waits in the queue
+	time.Sleep(time.Millisecond * 10)
+
+	assert.Equal(t, action.ErrBulkheadFull, fn.Do(ctx))
+
+	timeout, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+	defer cancel()
+	close(release)
+	time.Sleep(time.Millisecond * 10)
+	assert.Nil(t, fn.Do(timeout))
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	calls := int32(0)
+	fn := Run(&calls).Use(action.RateLimit(100, 5))
+
+	startedAt := time.Now()
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, fn.Do(ctx))
+	}
+	elapsed := time.Since(startedAt)
+	assert.Equal(t, int32(10), calls)
+	assert.True(t, elapsed >= time.Millisecond*40, "expected 5 calls to wait for tokens")
+
+	timeout, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	slow := Run(&calls).Use(action.RateLimit(1, 1))
+	assert.Nil(t, slow.Do(timeout))
+	assert.Equal(t, context.DeadlineExceeded, slow.Do(timeout))
+}
+
+func TestRateLimitClock(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Now())
+	calls := int32(0)
+	fn := Run(&calls).Use(action.RateLimit(1, 1, action.WithClock(fake)))
+
+	assert.Nil(t, fn.Do(context.Background()))
+
+	done := make(chan error, 1)
+	go func() { done <- fn.Do(context.Background()) }()
+
+	fake.BlockUntil(1)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	fake.Advance(time.Second)
+
+	assert.Nil(t, <-done)
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestLimitValidation(t *testing.T) {
+	assert.Panics(t, func() { action.Bulkhead(0) })
+	assert.Panics(t, func() { action.Bulkhead(-1) })
+	assert.Panics(t, func() { action.RateLimit(0, 1) })
+	assert.Panics(t, func() { action.RateLimit(-1, 1) })
+	assert.Panics(t, func() { action.RateLimit(math.NaN(), 1) })
+	assert.Panics(t, func() { action.RateLimit(1e-12, 1) })
+
+	calls := int32(0)
+	unlimited := Run(&calls).Use(action.RateLimit(math.Inf(1), 1))
+	assert.Nil(t, unlimited.Do(context.Background()))
+	assert.Nil(t, unlimited.Do(context.Background()))
+	assert.Equal(t, int32(2), calls)
+}
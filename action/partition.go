@@ -0,0 +1,343 @@
+package action
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/altairsix/pkg/clock"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+const (
+	// ringReplicas is the number of points each member occupies on the Ring
+	ringReplicas = 64
+)
+
+// Membership tracks the live members of a cluster from the Ticks they publish.  A member is
+// considered live until timeout has elapsed since its most recent Tick.
+type Membership struct {
+	mutex   sync.Mutex
+	timeout time.Duration
+	members map[string]time.Time
+}
+
+// NewMembership returns a new Membership that expires members not heard from within timeout
+func NewMembership(timeout time.Duration) *Membership {
+	return &Membership{
+		timeout: timeout,
+		members: map[string]time.Time{},
+	}
+}
+
+// Observe records a Tick received at the time provided; returns true if the member is new
+func (m *Membership) Observe(tick Tick, now time.Time) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	_, ok := m.members[tick.ID]
+	m.members[tick.ID] = now
+	return !ok
+}
+
+// Expire removes members not heard from within the timeout; returns true if any were removed
+func (m *Membership) Expire(now time.Time) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	expired := false
+	for id, seenAt := range m.members {
+		if now.Sub(seenAt) > m.timeout {
+			delete(m.members, id)
+			expired = true
+		}
+	}
+	return expired
+}
+
+// Members returns the ids of the live members in sorted order
+func (m *Membership) Members() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ids := make([]string, 0, len(m.members))
+	for id := range m.members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Ring assigns keys to members using consistent hashing so that only a fraction of keys move
+// when members join or leave
+type Ring struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+func hash(s string) uint64 {
+	sum := sha1.Sum([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// NewRing returns a Ring containing the members provided
+func NewRing(members ...string) *Ring {
+	ring := &Ring{
+		points: make([]uint64, 0, len(members)*ringReplicas),
+		owners: make(map[uint64]string, len(members)*ringReplicas),
+	}
+
+	for _, member := range members {
+		for i := 0; i < ringReplicas; i++ {
+			point := hash(member + "#" + strconv.Itoa(i))
+			if owner, ok := ring.owners[point]; ok {
+				if member < owner {
+					ring.owners[point] = member // resolve collisions deterministically
+				}
+				continue
+			}
+			ring.points = append(ring.points, point)
+			ring.owners[point] = member
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+
+	return ring
+}
+
+// Owner returns the member that owns the key or the empty string if the Ring has no members
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	point := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= point })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+type partitionKey struct{}
+
+// PartitionKey returns the key assigned to the action by Partitioned
+func PartitionKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(partitionKey{}).(string)
+	return key, ok
+}
+
+type keyExit struct {
+	key        string
+	generation int
+	err        error
+}
+
+type keyWorker struct {
+	generation int
+	cancel     func()
+	done       chan struct{}
+}
+
+type partition struct {
+	clock         clock.Clock
+	interval      time.Duration
+	memberTimeout time.Duration
+}
+
+// PartitionOption provides functional options to Partitioned
+type PartitionOption interface {
+	applyPartition(*partition)
+}
+
+type partitionFunc func(*partition)
+
+func (fn partitionFunc) applyPartition(p *partition) { fn(p) }
+
+// WithMemberTimeout specifies how long a member may go without publishing a heartbeat before
+// Partitioned considers it gone; defaults to 3x the interval
+func WithMemberTimeout(d time.Duration) PartitionOption {
+	return partitionFunc(func(p *partition) {
+		p.memberTimeout = d
+	})
+}
+
+// Partitioned returns a Filter that spreads keys across the live members of the cluster.  Members
+// find each other via the Heartbeat and each key is assigned to a live member using consistent
+// hashing.  The target action is run once for each key assigned to this member and may retrieve
+// its key via PartitionKey.  When members join or leave, keys are rebalanced; the context of a
+// reassigned key is canceled and the key is not started again on this member until its action has
+// exited.  Heartbeats continue while revoked actions exit.  An action that exits is restarted on
+// the next heartbeat if the key is still assigned.
+//
+// Ownership is eventually consistent.  Each member assigns keys from its own view of the
+// membership, and views differ while heartbeats propagate, while a member is partitioned from the
+// others, or while a revoked action is still exiting.  During those windows a key may run on more
+// than one member, or on none.  Actions must tolerate concurrent, at-least-once execution e.g. by
+// using idempotent writes or a lease.
+//
+// WithInterval controls how often heartbeats are published and WithMemberTimeout how long a
+// member may go unheard before its keys are reassigned.
+//
+//	action.Partitioned(hb, tenants).AndThen(func(ctx context.Context) error {
+//		tenant, _ := action.PartitionKey(ctx)
+//		return project(ctx, tenant)
+//	})
+func Partitioned(heartbeat Heartbeat, keys []string, opts ...PartitionOption) Filter {
+	cfg := &partition{
+		clock:    clock.System,
+		interval: time.Second * 3,
+	}
+	for _, opt := range opts {
+		opt.applyPartition(cfg)
+	}
+
+	memberTimeout := cfg.memberTimeout
+	if memberTimeout <= 0 {
+		memberTimeout = cfg.interval * 3
+	}
+
+	return func(a Action) Action {
+		return func(ctx context.Context) error {
+			id := strconv.FormatInt(r.Int63(), 36)
+			self := Tick{ID: id, StartedAt: cfg.clock.Now()}
+
+			segment, ctx := tracer.NewSegment(ctx, "action:partitioned", log.Int("keys", len(keys)))
+			segment.SetBaggageItem("partition-id", id)
+			defer segment.Finish()
+
+			ch, err := heartbeat.Receive(ctx)
+			if err != nil {
+				return err
+			}
+
+			quit := make(chan struct{})
+			defer close(quit)
+
+			membership := NewMembership(memberTimeout)
+			membership.Observe(self, cfg.clock.Now())
+
+			exits := make(chan keyExit)
+			workers := map[string]*keyWorker{}
+			stopping := map[string]*keyWorker{} // revoked keys whose actions have yet to exit
+			generation := 0
+
+			start := func(key string) {
+				generation++
+				child, cancel := context.WithCancel(context.WithValue(ctx, partitionKey{}, key))
+				w := &keyWorker{
+					generation: generation,
+					cancel:     cancel,
+					done:       make(chan struct{}),
+				}
+				workers[key] = w
+
+				segment.Info("partitioned:assigned", log.String("key", key))
+
+				go func() {
+					err := a.Do(child)
+					close(w.done)
+
+					select {
+					case exits <- keyExit{key: key, generation: w.generation, err: err}:
+					case <-quit:
+					}
+				}()
+			}
+
+			// stop cancels the key's action without waiting for it to exit so that heartbeats are not
+			// held up; the exit is observed via exits
+			stop := func(key string) {
+				w, ok := workers[key]
+				if !ok {
+					return
+				}
+				delete(workers, key)
+				stopping[key] = w
+
+				w.cancel()
+			}
+
+			stopAll := func() {
+				for key := range workers {
+					stop(key)
+				}
+				for key, w := range stopping {
+					<-w.done
+					segment.Info("partitioned:revoked", log.String("key", key))
+				}
+			}
+
+			rebalance := func() {
+				members := membership.Members()
+				ring := NewRing(members...)
+
+				owned := map[string]bool{}
+				for _, key := range keys {
+					if ring.Owner(key) == id {
+						owned[key] = true
+					}
+				}
+
+				for key := range workers {
+					if !owned[key] {
+						stop(key)
+					}
+				}
+				for _, key := range keys {
+					if _, ok := stopping[key]; ok {
+						continue // started on a later heartbeat once the previous action exits
+					}
+					if _, ok := workers[key]; owned[key] && !ok {
+						start(key)
+					}
+				}
+			}
+
+			t := cfg.clock.NewTicker(jitter(cfg.interval))
+			defer t.Stop()
+
+			heartbeat.Publish(self)
+
+			for {
+				select {
+				case <-ctx.Done():
+					segment.Info("partitioned:canceled")
+					stopAll()
+					return nil
+
+				case v := <-ch:
+					if membership.Observe(v, cfg.clock.Now()) {
+						segment.Info("partitioned:member_joined", log.String("member", v.ID))
+					}
+
+				case e := <-exits:
+					if w, ok := stopping[e.key]; ok && w.generation == e.generation {
+						delete(stopping, e.key)
+						segment.Info("partitioned:revoked", log.String("key", e.key))
+					} else if w, ok := workers[e.key]; ok && w.generation == e.generation {
+						delete(workers, e.key)
+						w.cancel()
+						if e.err != nil {
+							segment.Info("partitioned:err", log.String("key", e.key), log.Error(e.err))
+						}
+					}
+
+				case <-t.C():
+					heartbeat.Publish(self)
+
+					membership.Observe(self, cfg.clock.Now())
+					if membership.Expire(cfg.clock.Now()) {
+						segment.Info("partitioned:member_left")
+					}
+					rebalance()
+				}
+			}
+		}
+	}
+}
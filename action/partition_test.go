@@ -0,0 +1,232 @@
+package action_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/action/heartbeat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	keys := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, "key-"+strconv.Itoa(i))
+	}
+
+	assert.Equal(t, "", action.NewRing().Owner("a"))
+
+	before := action.NewRing("a", "b", "c")
+	after := action.NewRing("a", "b", "c", "d")
+
+	counts := map[string]int{}
+	moved := 0
+	for _, key := range keys {
+		owner := before.Owner(key)
+		counts[owner]++
+
+		if v := after.Owner(key); v != owner {
+			assert.Equal(t, "d", v, "keys should only move to the new member")
+			moved++
+		}
+	}
+
+	assert.Len(t, counts, 3)
+	for member, count := range counts {
+		assert.True(t, count > 200, "expected member, %v, to own a fair share of keys; got %v", member, count)
+	}
+	assert.True(t, moved > 100 && moved < 400, "expected roughly a quarter of the keys to move; got %v", moved)
+}
+
+func TestMembership(t *testing.T) {
+	now := time.Now()
+	m := action.NewMembership(time.Second)
+
+	assert.True(t, m.Observe(action.Tick{ID: "b"}, now))
+	assert.True(t, m.Observe(action.Tick{ID: "a"}, now.Add(time.Second)))
+	assert.False(t, m.Observe(action.Tick{ID: "a"}, now.Add(time.Second)))
+	assert.Equal(t, []string{"a", "b"}, m.Members())
+
+	assert.True(t, m.Expire(now.Add(time.Second*2)))
+	assert.False(t, m.Expire(now.Add(time.Second*2)))
+	assert.Equal(t, []string{"a"}, m.Members())
+}
+
+type owners struct {
+	mutex sync.Mutex
+	keys  map[string][]string
+}
+
+func (o *owners) run(node string) action.Action {
+	return func(ctx context.Context) error {
+		key, _ := action.PartitionKey(ctx)
+
+		o.mutex.Lock()
+		o.keys[key] = append(o.keys[key], node)
+		o.mutex.Unlock()
+
+		<-ctx.Done()
+
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		for i, v := range o.keys[key] {
+			if v == node {
+				o.keys[key] = append(o.keys[key][:i], o.keys[key][i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+}
+
+// assigned returns the number of keys owned by exactly one node
+func (o *owners) assigned() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	n := 0
+	for _, nodes := range o.keys {
+		if len(nodes) == 1 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPartitioned(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	o := &owners{keys: map[string][]string{}}
+	bus := heartbeat.Memory()
+	interval := time.Millisecond * 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cancels := map[string]func(){}
+	var wg sync.WaitGroup
+	for _, node := range []string{"x", "y", "z"} {
+		child, cancelNode := context.WithCancel(ctx)
+		cancels[node] = cancelNode
+
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			err := action.Partitioned(bus.Node(node), keys, action.WithInterval(interval)).
+				AndThen(o.run(node)).
+				Do(child)
+			assert.Nil(t, err)
+		}(node)
+	}
+
+	waitFor := func(label string, fn func() bool) {
+		timeout := time.After(time.Second * 5)
+		for !fn() {
+			select {
+			case <-timeout:
+				t.Fatalf("timed out waiting for %v", label)
+			case <-time.After(interval):
+			}
+		}
+	}
+
+	// each key owned by exactly one node and spread across nodes; before members discover one
+	// another, a single node may briefly own every key
+	waitFor("keys spread across nodes", func() bool {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+
+		nodes := map[string]bool{}
+		for _, v := range o.keys {
+			if len(v) != 1 {
+				return false
+			}
+			nodes[v[0]] = true
+		}
+		return len(o.keys) == len(keys) && len(nodes) > 1
+	})
+
+	// node leaves; its keys should be taken over by the remaining nodes
+	cancels["x"]()
+	waitFor("keys rebalanced", func() bool {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		for _, v := range o.keys {
+			if len(v) != 1 || v[0] == "x" {
+				return false
+			}
+		}
+		return len(o.keys) == len(keys)
+	})
+
+	cancel()
+	wg.Wait()
+	assert.Equal(t, 0, o.assigned())
+}
+
+type countingHeartbeat struct {
+	action.Heartbeat
+	published int32
+}
+
+func (c *countingHeartbeat) Publish(tick action.Tick) error {
+	atomic.AddInt32(&c.published, 1)
+	return c.Heartbeat.Publish(tick)
+}
+
+func TestPartitionedStopDoesNotBlockHeartbeats(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	bus := heartbeat.Memory()
+	interval := time.Millisecond * 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// x ignores cancellation of its revoked keys until released
+	release := make(chan struct{})
+	revoked := int32(0)
+	x := &countingHeartbeat{Heartbeat: bus.Node("x")}
+	stuck := func(ctx context.Context) error {
+		<-ctx.Done()
+		atomic.AddInt32(&revoked, 1)
+		<-release
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		action.Partitioned(x, keys, action.WithInterval(interval)).AndThen(stuck).Do(ctx)
+	}()
+
+	time.Sleep(interval * 5) // x owns every key before y joins
+	go func() {
+		defer wg.Done()
+		action.Partitioned(bus.Node("y"), keys, action.WithInterval(interval)).AndThen(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}).Do(ctx)
+	}()
+
+	timeout := time.After(time.Second * 5)
+	for atomic.LoadInt32(&revoked) == 0 {
+		select {
+		case <-timeout:
+			t.Fatal("timed out waiting for keys to be revoked from x")
+		case <-time.After(interval):
+		}
+	}
+
+	published := atomic.LoadInt32(&x.published)
+	time.Sleep(interval * 10)
+	assert.True(t, atomic.LoadInt32(&x.published) > published, "expected heartbeats while revoked actions exit")
+
+	close(release)
+	cancel()
+	wg.Wait()
+}
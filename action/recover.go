@@ -0,0 +1,71 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// PanicError is returned by Recover when the action panics
+type PanicError struct {
+	// Value passed to panic
+	Value interface{}
+
+	// Stack trace of the goroutine at the time of the panic
+	Stack []byte
+}
+
+// Error implements the error interface
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Cause returns the panic value if it was an error
+func (p *PanicError) Cause() error {
+	if err, ok := p.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// NewPanicError captures the value returned by recover along with the current stack.  Must
+// be called from the deferred function that invoked recover for the stack to be meaningful.
+func NewPanicError(v interface{}) *PanicError {
+	return &PanicError{
+		Value: v,
+		Stack: debug.Stack(),
+	}
+}
+
+// IsPanic returns true if err, or any of its causes, is a *PanicError
+func IsPanic(err error) bool {
+	return tracer.HasErr(err, func(err error) bool {
+		_, ok := err.(*PanicError)
+		return ok
+	})
+}
+
+// Recover converts panics in the action into a *PanicError so that filters like Forever and
+// Retry treat them as any other failure
+func Recover() Filter {
+	return func(a Action) Action {
+		return func(ctx context.Context) (err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					pe := NewPanicError(v)
+					tracer.SegmentFromContext(ctx).LogFields(
+						log.String("event", "action:panic"),
+						log.Error(pe),
+						log.String("stack", string(pe.Stack)),
+					)
+					err = pe
+				}
+			}()
+
+			return a.Do(ctx)
+		}
+	}
+}
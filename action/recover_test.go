@@ -0,0 +1,60 @@
+package action_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecover(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("panic value", func(t *testing.T) {
+		a := action.Action(func(ctx context.Context) error {
+			panic("boom")
+		})
+
+		err := a.Use(action.Recover()).Do(ctx)
+		assert.True(t, action.IsPanic(err))
+
+		pe := err.(*action.PanicError)
+		assert.Equal(t, "boom", pe.Value)
+		assert.True(t, strings.Contains(string(pe.Stack), "recover_test.go"))
+	})
+
+	t.Run("panic error", func(t *testing.T) {
+		a := action.Action(func(ctx context.Context) error {
+			panic(io.ErrUnexpectedEOF)
+		})
+
+		err := a.Use(action.Recover()).Do(ctx)
+		assert.Equal(t, io.ErrUnexpectedEOF, err.(*action.PanicError).Cause())
+	})
+
+	t.Run("no panic", func(t *testing.T) {
+		calls := int32(0)
+		err := Run(&calls).Use(action.Recover()).Do(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1), calls)
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		calls := 0
+		a := action.Action(func(ctx context.Context) error {
+			calls++
+			if calls == 1 {
+				panic("boom")
+			}
+			return nil
+		})
+
+		err := a.Use(action.Retry(1, time.Millisecond), action.Recover()).Do(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, calls)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/altairsix/pkg/clock"
 	"github.com/altairsix/pkg/tracer"
 	"github.com/opentracing/opentracing-go/log"
 )
@@ -20,53 +21,114 @@ type Heartbeat interface {
 }
 
 type singleton struct {
-	interval  time.Duration
-	elections time.Duration
-	lease     time.Duration
+	clock      clock.Clock
+	interval   time.Duration
+	elections  time.Duration
+	lease      time.Duration
+	leadership *Leadership
+	onElected  LeadershipFunc
+	onLost     LeadershipFunc
+	onFollower LeadershipFunc
 }
 
-type SingletonOption func(*singleton)
+// SingletonOption provides functional options to Singleton
+type SingletonOption interface {
+	applySingleton(*singleton)
+}
 
-func WithInterval(d time.Duration) SingletonOption {
-	return func(s *singleton) {
-		s.interval = d
-	}
+type singletonFunc func(*singleton)
+
+func (fn singletonFunc) applySingleton(s *singleton) { fn(s) }
+
+// IntervalOption is accepted by both Singleton and Partitioned
+type IntervalOption interface {
+	SingletonOption
+	PartitionOption
+}
+
+type intervalOption time.Duration
+
+func (d intervalOption) applySingleton(s *singleton) { s.interval = time.Duration(d) }
+func (d intervalOption) applyPartition(p *partition) { p.interval = time.Duration(d) }
+
+// WithInterval specifies how often heartbeats are published; defaults to 3s
+func WithInterval(d time.Duration) IntervalOption {
+	return intervalOption(d)
 }
 
 func WithElections(d time.Duration) SingletonOption {
-	return func(s *singleton) {
+	return singletonFunc(func(s *singleton) {
 		s.elections = d
-	}
+	})
 }
 
 func WithLease(d time.Duration) SingletonOption {
-	return func(s *singleton) {
+	return singletonFunc(func(s *singleton) {
 		s.lease = d
-	}
+	})
+}
+
+// WithLeadership records the role of the singleton in the Leadership provided
+func WithLeadership(l *Leadership) SingletonOption {
+	return singletonFunc(func(s *singleton) {
+		s.leadership = l
+	})
+}
+
+// OnElected is called when this instance becomes the leader.  ctx is canceled when leadership ends.
+func OnElected(fn LeadershipFunc) SingletonOption {
+	return singletonFunc(func(s *singleton) {
+		s.onElected = fn
+	})
+}
+
+// OnLostLeadership is called when this instance stops being the leader
+func OnLostLeadership(fn LeadershipFunc) SingletonOption {
+	return singletonFunc(func(s *singleton) {
+		s.onLost = fn
+	})
+}
+
+// OnFollower is called when this instance defers to an older instance
+func OnFollower(fn LeadershipFunc) SingletonOption {
+	return singletonFunc(func(s *singleton) {
+		s.onFollower = fn
+	})
 }
 
 // Singleton takes an instance and ensure that only a single instance of it will
 // run
 func Singleton(heartbeat Heartbeat, opts ...SingletonOption) Filter {
 	cfg := &singleton{
-		interval:  time.Second * 3,
-		elections: time.Second * 13,
-		lease:     time.Minute * 13,
+		clock:      clock.System,
+		interval:   time.Second * 3,
+		elections:  time.Second * 13,
+		lease:      time.Minute * 13,
+		leadership: NewLeadership(),
 	}
 
 	for _, opt := range opts {
-		opt(cfg)
+		opt.applySingleton(cfg)
+	}
+
+	notify := func(ctx context.Context, fn LeadershipFunc) {
+		if fn != nil {
+			fn(ctx, cfg.leadership.Status())
+		}
 	}
 
 	return func(a Action) Action {
 		return func(ctx context.Context) error {
 			id := strconv.FormatInt(r.Int63(), 36)
-			startedAt := time.Now()
+			startedAt := cfg.clock.Now()
 
 			segment, ctx := tracer.NewSegment(ctx, "action:singleton")
 			segment.SetBaggageItem("singleton-id", id)
 			defer segment.Finish()
 
+			self := Tick{ID: id, StartedAt: startedAt}
+			cfg.leadership.set(RoleCandidate, self, Tick{})
+
 			ch, err := heartbeat.Receive(ctx)
 			if err != nil {
 				return err
@@ -77,19 +139,21 @@ func Singleton(heartbeat Heartbeat, opts ...SingletonOption) Filter {
 
 			leader := false
 			leases := make([]time.Time, 0, 12)
+			oldest := Tick{} // oldest instance seen; presumed to be the leader
 
-			t := time.NewTicker(jitter(cfg.interval))
+			stepDown := func() {
+				cfg.leadership.set(RoleFollower, self, oldest)
+				notify(ctx, cfg.onLost)
+			}
+
+			t := cfg.clock.NewTicker(jitter(cfg.interval))
 			defer t.Stop()
 
-			election := time.NewTicker(cfg.elections)
+			election := cfg.clock.NewTicker(cfg.elections)
 			defer election.Stop()
 
-			run := func() {
-				finished = make(chan error, 1) // done is scoped to our parent
+			run := func(child context.Context) {
 				defer close(finished)
-
-				var child context.Context
-				child, cancel = context.WithCancel(ctx) // child and cancel are also both scoped to our parent
 				defer cancel()
 
 				childSegment, child := tracer.NewSegment(child, "singleton:run:finished")
@@ -103,20 +167,26 @@ func Singleton(heartbeat Heartbeat, opts ...SingletonOption) Filter {
 				select {
 				case <-ctx.Done():
 					segment.Info("singleton:canceled")
+					if leader {
+						stepDown()
+					}
 					return nil
 
 				case v := <-ch:
 					if v.ID != id && v.StartedAt.Before(startedAt) {
-						leases = append(leases, time.Now().Add(cfg.lease))
+						leases = append(leases, cfg.clock.Now().Add(cfg.lease))
+						if oldest.ID == "" || v.StartedAt.Before(oldest.StartedAt) {
+							oldest = v
+						}
 					}
 
-				case <-t.C:
+				case <-t.C():
 					heartbeat.Publish(Tick{
 						ID:        id,
 						StartedAt: startedAt,
 					})
 
-					now := time.Now()
+					now := cfg.clock.Now()
 					for len(leases) > 0 && leases[0].Before(now) {
 						leases = leases[1:]
 					}
@@ -129,22 +199,31 @@ func Singleton(heartbeat Heartbeat, opts ...SingletonOption) Filter {
 					if err != nil {
 						segment.LogFields(log.Error(err))
 					}
+					stepDown()
 					return err
 
-				case <-election.C:
+				case <-election.C():
 					if leader {
 						continue
 					}
 
 					if count := len(leases); count != 0 {
+						cfg.leadership.set(RoleFollower, self, oldest)
+						notify(ctx, cfg.onFollower)
 						cancel()
 						return nil
 					}
 
 					segment.Info("singleton:elected_leader")
-					go run()
+
+					child, cancelChild := context.WithCancel(ctx) // child and cancel are also both scoped to our parent
+					finished, cancel = make(chan error, 1), cancelChild
 
 					leader = true
+					cfg.leadership.set(RoleLeader, self, self)
+					notify(child, cfg.onElected)
+
+					go run(child)
 				}
 			}
 		}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/clock"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,36 +38,113 @@ func TestSingleton(t *testing.T) {
 	}
 
 	interval := time.Millisecond * 50
+	fake := clock.NewFake(time.Now())
 
-	ctx, cancel := context.WithCancel(context.Background())
+	calls := int32(0)
+	started := make(chan struct{})
+	a := func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		<-ctx.Done()
+		return nil
+	}
+	singleton := action.Singleton(mock,
+		action.WithInterval(interval),
+		action.WithElections(interval*3),
+		action.WithLease(interval*10),
+		action.WithClock(fake),
+	)
 
-	// Cancel after 25 ticks
+	done := make(chan error, 1)
 	go func() {
-		defer cancel()
-		time.Sleep(interval * 25)
+		done <- singleton.AndThen(a).Do(context.Background())
 	}()
 
-	// New leader on the scene after 6 ticks
+	// wait for the heartbeat and election tickers and then hold an election
+	fake.BlockUntil(2)
+	fake.Advance(interval * 3)
+	<-started
+
+	// new leader on the scene
+	mock.ch <- action.Tick{StartedAt: fake.Now().Add(-time.Hour)}
+	fake.Advance(interval * 2)
+
+	assert.Nil(t, <-done)
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestSingletonLeadership(t *testing.T) {
+	ch := make(chan action.Tick)
+	defer close(ch)
+	mock := &MockHeartbeat{
+		ch: ch,
+	}
+
+	interval := time.Millisecond * 25
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	elected := make(chan action.LeadershipStatus, 1)
+	lost := make(chan action.LeadershipStatus, 1)
+	leadership := action.NewLeadership()
+	singleton := action.Singleton(mock,
+		action.WithInterval(interval),
+		action.WithElections(interval*3),
+		action.WithLease(interval*10),
+		action.WithLeadership(leadership),
+		action.OnElected(func(ctx context.Context, status action.LeadershipStatus) { elected <- status }),
+		action.OnLostLeadership(func(ctx context.Context, status action.LeadershipStatus) { lost <- status }),
+	)
+
+	assert.Equal(t, action.RoleCandidate, leadership.Status().Role)
+
+	done := make(chan error, 1)
 	go func() {
-		time.Sleep(interval * 6)
-		mock.ch <- action.Tick{StartedAt: time.Now().Add(-time.Hour)}
+		done <- singleton.AndThen(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}).Do(ctx)
 	}()
 
-	calls := int32(0)
-	a := func(ctx context.Context) error {
-		atomic.AddInt32(&calls, 1)
-		select {
-		case <-ctx.Done():
-		case <-time.After(time.Minute):
-		}
-		return nil
+	status := <-elected
+	assert.True(t, status.IsLeader())
+	assert.Equal(t, status.ID, status.LeaderID)
+	assert.Equal(t, action.RoleLeader, leadership.Status().Role)
+
+	// an older instance appears
+	older := action.Tick{ID: "older", StartedAt: time.Now().Add(-time.Hour)}
+	mock.ch <- older
+
+	status = <-lost
+	assert.Equal(t, action.RoleFollower, status.Role)
+	assert.Equal(t, older.ID, status.LeaderID)
+	assert.True(t, older.StartedAt.Equal(status.LeaderStartedAt))
+	assert.Nil(t, <-done)
+}
+
+func TestSingletonFollower(t *testing.T) {
+	ch := make(chan action.Tick, 1)
+	mock := &MockHeartbeat{
+		ch: ch,
 	}
+
+	interval := time.Millisecond * 25
+	follower := make(chan action.LeadershipStatus, 1)
 	singleton := action.Singleton(mock,
 		action.WithInterval(interval),
 		action.WithElections(interval*3),
 		action.WithLease(interval*10),
+		action.OnFollower(func(ctx context.Context, status action.LeadershipStatus) { follower <- status }),
 	)
-	err := singleton.AndThen(a).Do(ctx)
+
+	ch <- action.Tick{ID: "older", StartedAt: time.Now().Add(-time.Hour)}
+
+	calls := int32(0)
+	err := singleton.AndThen(Run(&calls)).Do(context.Background())
 	assert.Nil(t, err)
-	assert.Equal(t, int32(1), calls)
+	assert.Equal(t, int32(0), calls)
+
+	status := <-follower
+	assert.Equal(t, action.RoleFollower, status.Role)
+	assert.Equal(t, "older", status.LeaderID)
 }
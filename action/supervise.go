@@ -0,0 +1,326 @@
+package action
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/altairsix/pkg/clock"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+)
+
+// Strategy determines which children are restarted when a child exits
+type Strategy int
+
+const (
+	// OneForOne restarts only the child that exited
+	OneForOne Strategy = iota
+
+	// OneForAll stops and restarts all children when any child exits
+	OneForAll
+
+	// RestForOne stops and restarts the child that exited along with all children started after it
+	RestForOne
+)
+
+// String renders the Strategy as a string
+func (s Strategy) String() string {
+	switch s {
+	case OneForOne:
+		return "one-for-one"
+	case OneForAll:
+		return "one-for-all"
+	case RestForOne:
+		return "rest-for-one"
+	default:
+		return "unknown:" + strconv.Itoa(int(s))
+	}
+}
+
+// Restart determines when a child is restarted
+type Restart int
+
+const (
+	// RestartPermanent children are always restarted
+	RestartPermanent Restart = iota
+
+	// RestartTransient children are restarted only if they return an error
+	RestartTransient
+
+	// RestartTemporary children are never restarted
+	RestartTemporary
+)
+
+// SuperviseOption configures Supervise; both Child values and options such as WithStrategy
+// or WithClock may be passed
+type SuperviseOption interface {
+	applySupervise(*supervise)
+}
+
+type superviseFunc func(*supervise)
+
+func (fn superviseFunc) applySupervise(s *supervise) { fn(s) }
+
+// Child describes an action managed by Supervise
+type Child struct {
+	// Name identifies the child in logs
+	Name string
+
+	// Action to run
+	Action Action
+
+	// Restart determines when the child is restarted; defaults to RestartPermanent
+	Restart Restart
+}
+
+func (c Child) applySupervise(s *supervise) {
+	s.children = append(s.children, c)
+}
+
+// WithStrategy specifies the restart strategy; defaults to OneForOne
+func WithStrategy(strategy Strategy) SuperviseOption {
+	return superviseFunc(func(s *supervise) {
+		s.strategy = strategy
+	})
+}
+
+// WithIntensity specifies the maximum number of restarts allowed within the period provided.
+// When the limit is exceeded, all children are stopped and Supervise returns an error.
+func WithIntensity(maxRestarts int, within time.Duration) SuperviseOption {
+	return superviseFunc(func(s *supervise) {
+		s.maxRestarts = maxRestarts
+		s.within = within
+	})
+}
+
+// WithRestartDelay specifies how long to wait before restarting children
+func WithRestartDelay(d time.Duration) SuperviseOption {
+	return superviseFunc(func(s *supervise) {
+		s.restartDelay = d
+	})
+}
+
+// WithShutdownTimeout bounds how long to wait for each child to exit once canceled; defaults to
+// 30s.  0 waits for each child to exit however long it takes.
+func WithShutdownTimeout(d time.Duration) SuperviseOption {
+	return superviseFunc(func(s *supervise) {
+		s.shutdownTimeout = d
+	})
+}
+
+type supervise struct {
+	clock           clock.Clock
+	strategy        Strategy
+	maxRestarts     int
+	within          time.Duration
+	restartDelay    time.Duration
+	shutdownTimeout time.Duration
+	children        []Child
+}
+
+// detached carries the values of the parent context, but not its cancellation; allows children
+// to be stopped in a controlled order when the parent is canceled
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+type childExit struct {
+	index      int
+	generation int
+	err        error
+}
+
+type childState struct {
+	Child
+	running    bool
+	generation int
+	cancel     func()
+	done       chan struct{}
+}
+
+// Supervise returns an action that runs the children provided, restarting them according to
+// the configured strategy.  Children are started in the order provided and stopped in reverse
+// order.  The action returns nil once the context is canceled and all children have stopped,
+// or an error if the restart intensity is exceeded.
+//
+//	action.Supervise(
+//		action.WithStrategy(action.RestForOne),
+//		action.Child{Name: "publisher", Action: publisher},
+//		action.Child{Name: "http", Action: server},
+//	)
+func Supervise(opts ...SuperviseOption) Action {
+	cfg := &supervise{
+		clock:           clock.System,
+		strategy:        OneForOne,
+		maxRestarts:     3,
+		within:          time.Second * 5,
+		shutdownTimeout: time.Second * 30,
+	}
+
+	for _, opt := range opts {
+		opt.applySupervise(cfg)
+	}
+
+	return func(ctx context.Context) error {
+		segment, ctx := tracer.NewSegment(ctx, "action:supervise", log.String("strategy", cfg.strategy.String()))
+		defer segment.Finish()
+
+		quit := make(chan struct{})
+		defer close(quit)
+
+		exits := make(chan childExit)
+		children := make([]*childState, 0, len(cfg.children))
+		for _, child := range cfg.children {
+			children = append(children, &childState{Child: child})
+		}
+
+		start := func(i int) {
+			c := children[i]
+			child, cancel := context.WithCancel(detached{Context: ctx})
+			c.generation++
+			c.running = true
+			c.cancel = cancel
+			c.done = make(chan struct{})
+
+			segment.Info("supervise:child_started", log.String("child", c.Name), log.Int("generation", c.generation))
+
+			go func(done chan struct{}, generation int) {
+				err := c.Action.Do(child)
+				close(done)
+
+				select {
+				case exits <- childExit{index: i, generation: generation, err: err}:
+				case <-quit:
+				}
+			}(c.done, c.generation)
+		}
+
+		stop := func(i int) {
+			c := children[i]
+			if !c.running {
+				return
+			}
+
+			c.cancel()
+			c.running = false
+
+			var timeout <-chan time.Time
+			if cfg.shutdownTimeout > 0 {
+				timer := cfg.clock.NewTimer(cfg.shutdownTimeout)
+				defer timer.Stop()
+				timeout = timer.C()
+			}
+
+			select {
+			case <-c.done:
+				segment.Info("supervise:child_stopped", log.String("child", c.Name))
+			case <-timeout:
+				segment.Info("supervise:child_shutdown_timeout", log.String("child", c.Name))
+			}
+		}
+
+		stopAll := func(from int) {
+			for i := len(children) - 1; i >= from; i-- {
+				stop(i)
+			}
+		}
+
+		running := func() bool {
+			for _, c := range children {
+				if c.running {
+					return true
+				}
+			}
+			return false
+		}
+
+		for i := range children {
+			start(i)
+		}
+
+		var restarts []time.Time
+		for running() {
+			select {
+			case <-ctx.Done():
+				segment.Info("supervise:shutdown")
+				stopAll(0)
+				return nil
+
+			case e := <-exits:
+				c := children[e.index]
+				if e.generation != c.generation || !c.running {
+					continue // child was stopped by the supervisor
+				}
+				c.running = false
+				c.cancel()
+
+				if e.err != nil {
+					segment.Info("supervise:child_failed", log.String("child", c.Name), log.Error(e.err))
+				} else {
+					segment.Info("supervise:child_exited", log.String("child", c.Name))
+				}
+
+				if c.Restart == RestartTemporary || (c.Restart == RestartTransient && e.err == nil) {
+					continue
+				}
+
+				now := cfg.clock.Now()
+				restarts = append(restarts, now)
+				for len(restarts) > 0 && now.Sub(restarts[0]) > cfg.within {
+					restarts = restarts[1:]
+				}
+				if len(restarts) > cfg.maxRestarts {
+					segment.Info("supervise:intensity_exceeded", log.String("child", c.Name), log.Int("restarts", len(restarts)))
+					stopAll(0)
+					if e.err == nil {
+						return errors.Errorf("supervisor exceeded %v restarts within %v; child, %v, exited", cfg.maxRestarts, cfg.within, c.Name)
+					}
+					return errors.Wrapf(e.err, "supervisor exceeded %v restarts within %v; child, %v, failed", cfg.maxRestarts, cfg.within, c.Name)
+				}
+
+				// determine which children to restart
+				from, to := e.index, e.index
+				switch cfg.strategy {
+				case OneForAll:
+					from, to = 0, len(children)-1
+				case RestForOne:
+					to = len(children) - 1
+				}
+
+				restart := make([]bool, len(children))
+				for i := from; i <= to; i++ {
+					restart[i] = i == e.index || children[i].running
+				}
+				for i := to; i >= from; i-- {
+					stop(i)
+				}
+
+				if cfg.restartDelay > 0 {
+					select {
+					case <-ctx.Done():
+						segment.Info("supervise:shutdown")
+						stopAll(0)
+						return nil
+					case <-cfg.clock.After(cfg.restartDelay):
+					}
+				}
+
+				for i := from; i <= to; i++ {
+					if restart[i] {
+						segment.Info("supervise:child_restarting", log.String("child", children[i].Name))
+						start(i)
+					}
+				}
+			}
+		}
+
+		segment.Info("supervise:all_children_exited")
+		return nil
+	}
+}
@@ -0,0 +1,232 @@
+package action_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) Events() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// blocking returns an action that runs until canceled
+func blocking(name string, rec *recorder) action.Action {
+	return func(ctx context.Context) error {
+		rec.add("start:" + name)
+		<-ctx.Done()
+		rec.add("stop:" + name)
+		return nil
+	}
+}
+
+// failOnce returns an action that fails the first time it runs and then blocks
+func failOnce(name string, rec *recorder) action.Action {
+	calls := int32(0)
+	return func(ctx context.Context) error {
+		rec.add("start:" + name)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(time.Millisecond * 10) // ensure all children started
+			return io.ErrUnexpectedEOF
+		}
+		<-ctx.Done()
+		rec.add("stop:" + name)
+		return nil
+	}
+}
+
+func TestSuperviseOrder(t *testing.T) {
+	rec := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- action.Supervise(
+			action.Child{Name: "a", Action: blocking("a", rec)},
+			action.Child{Name: "b", Action: blocking("b", rec)},
+			action.Child{Name: "c", Action: blocking("c", rec)},
+		).Do(ctx)
+	}()
+
+	time.Sleep(time.Millisecond * 25)
+	cancel()
+	assert.Nil(t, <-done)
+
+	events := rec.Events()
+	assert.Len(t, events, 6)
+	assert.Equal(t, []string{"stop:c", "stop:b", "stop:a"}, events[3:])
+}
+
+func TestSuperviseStrategies(t *testing.T) {
+	testCases := map[string]struct {
+		Strategy action.Strategy
+		Stopped  []string
+		Started  []string
+	}{
+		"one-for-one": {
+			Strategy: action.OneForOne,
+			Stopped:  []string{},
+			Started:  []string{"start:b"},
+		},
+		"one-for-all": {
+			Strategy: action.OneForAll,
+			Stopped:  []string{"stop:c", "stop:a"},
+			Started:  []string{"start:a", "start:b", "start:c"},
+		},
+		"rest-for-one": {
+			Strategy: action.RestForOne,
+			Stopped:  []string{"stop:c"},
+			Started:  []string{"start:b", "start:c"},
+		},
+	}
+
+	for label, tc := range testCases {
+		tc := tc
+		t.Run(label, func(t *testing.T) {
+			t.Parallel()
+
+			rec := &recorder{}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			done := make(chan error, 1)
+			go func() {
+				done <- action.Supervise(
+					action.WithStrategy(tc.Strategy),
+					action.Child{Name: "a", Action: blocking("a", rec)},
+					action.Child{Name: "b", Action: failOnce("b", rec)},
+					action.Child{Name: "c", Action: blocking("c", rec)},
+				).Do(ctx)
+			}()
+
+			time.Sleep(time.Millisecond * 100)
+			events := rec.Events()
+			cancel()
+			assert.Nil(t, <-done)
+
+			// skip the initial startup events; children are stopped in reverse order and then restarted
+			events = events[3:]
+			assert.Equal(t, len(tc.Stopped)+len(tc.Started), len(events))
+			if len(events) >= len(tc.Stopped) {
+				assert.Equal(t, tc.Stopped, events[:len(tc.Stopped)])
+				assert.ElementsMatch(t, tc.Started, events[len(tc.Stopped):])
+			}
+		})
+	}
+}
+
+func TestSuperviseIntensity(t *testing.T) {
+	calls := int32(0)
+	a := action.Action(func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return io.ErrUnexpectedEOF
+	})
+
+	err := action.Supervise(
+		action.WithIntensity(3, time.Minute),
+		action.Child{Name: "failing", Action: a},
+	).Do(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(4), calls)
+}
+
+func TestSuperviseRestart(t *testing.T) {
+	calls := int32(0)
+	a := action.Action(func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	err := action.Supervise(
+		action.Child{Name: "temporary", Action: a, Restart: action.RestartTemporary},
+		action.Child{Name: "transient", Action: a, Restart: action.RestartTransient},
+	).Do(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestSuperviseClock(t *testing.T) {
+	t.Run("restart delay", func(t *testing.T) {
+		fake := clock.NewFake(time.Now())
+		rec := &recorder{}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- action.Supervise(
+				action.WithClock(fake),
+				action.WithRestartDelay(time.Minute),
+				action.Child{Name: "a", Action: failOnce("a", rec)},
+			).Do(ctx)
+		}()
+
+		fake.BlockUntil(1) // waiting to restart
+		assert.Equal(t, []string{"start:a"}, rec.Events())
+
+		fake.Advance(time.Minute)
+		for len(rec.Events()) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, []string{"start:a", "start:a"}, rec.Events())
+
+		cancel()
+		assert.Nil(t, <-done)
+	})
+
+	t.Run("shutdown timeout", func(t *testing.T) {
+		fake := clock.NewFake(time.Now())
+		ctx, cancel := context.WithCancel(context.Background())
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		stubborn := action.Action(func(ctx context.Context) error {
+			close(started)
+			<-release // ignores cancellation
+			return nil
+		})
+
+		done := make(chan error, 1)
+		go func() {
+			done <- action.Supervise(
+				action.WithClock(fake),
+				action.WithShutdownTimeout(time.Minute),
+				action.Child{Name: "stubborn", Action: stubborn},
+			).Do(ctx)
+		}()
+
+		<-started
+		cancel()
+		fake.BlockUntil(1) // waiting for the child to exit
+
+		select {
+		case <-done:
+			t.Fatal("expected supervise to wait for the shutdown timeout")
+		default:
+		}
+
+		fake.Advance(time.Minute)
+		assert.Nil(t, <-done)
+	})
+}
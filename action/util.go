@@ -2,12 +2,55 @@ package action
 
 import (
 	"math/rand"
+	"sync"
 	"time"
 )
 
-var r = rand.New(rand.NewSource(time.Now().UnixNano()))
+var r = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())})
+
+// lockedSource allows the package level rand to be shared across goroutines
+type lockedSource struct {
+	mutex sync.Mutex
+	src   rand.Source
+}
+
+func (l *lockedSource) Int63() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.src.Int63()
+}
+
+func (l *lockedSource) Seed(seed int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.src.Seed(seed)
+}
 
 func jitter(d time.Duration) time.Duration {
 	fragment := d / 5
+	if fragment <= 0 {
+		return d
+	}
 	return d - fragment + time.Duration(r.Int63n(2*int64(fragment)))
 }
+
+// fullJitter returns a random duration in the range [0, d)
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(r.Int63n(int64(d)))
+}
+
+// decorrelatedJitter returns a random duration in the range [base, prev*3) capped at max
+func decorrelatedJitter(base, prev, max time.Duration) time.Duration {
+	upper := prev * 3
+	if upper <= base {
+		upper = base + 1
+	}
+	d := base + time.Duration(r.Int63n(int64(upper-base)))
+	if max > 0 && d > max {
+		d = max
+	}
+	return d
+}
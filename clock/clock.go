@@ -0,0 +1,96 @@
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock abstracts access to the current time and timers so that time may be controlled in tests
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// Since returns the time elapsed since t
+	Since(t time.Time) time.Duration
+
+	// After waits for the duration to elapse and then sends the current time on the returned channel
+	After(d time.Duration) <-chan time.Time
+
+	// Sleep pauses the current goroutine for at least the duration d
+	Sleep(d time.Duration)
+
+	// NewTimer creates a new Timer that will send the current time on its channel after at least duration d
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker returns a new Ticker that sends the time on its channel every d
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer mirrors *time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker mirrors *time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+var (
+	// System is the Clock backed by the time package
+	System Clock = systemClock{}
+)
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (systemClock) NewTimer(d time.Duration) Timer         { return systemTimer{Timer: time.NewTimer(d)} }
+func (systemClock) NewTicker(d time.Duration) Ticker       { return systemTicker{Ticker: time.NewTicker(d)} }
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (s systemTimer) C() <-chan time.Time { return s.Timer.C }
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (s systemTicker) C() <-chan time.Time { return s.Ticker.C }
+
+// Or returns c if not nil, otherwise System
+func Or(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
+
+// WithTimeout is the equivalent of context.WithTimeout using the clock provided to measure the
+// timeout.  When the timeout is measured by a clock other than System, the context reports
+// context.Canceled once the timeout elapses.
+func WithTimeout(ctx context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if c == nil || c == System {
+		return context.WithTimeout(ctx, d)
+	}
+
+	child, cancel := context.WithCancel(ctx)
+	timer := c.NewTimer(d)
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-child.Done():
+		case <-timer.C():
+			cancel()
+		}
+	}()
+
+	return child, cancel
+}
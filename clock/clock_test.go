@@ -0,0 +1,114 @@
+package clock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystem(t *testing.T) {
+	c := clock.Or(nil)
+	assert.Equal(t, clock.System, c)
+
+	startedAt := c.Now()
+	<-c.After(time.Millisecond)
+	assert.True(t, c.Since(startedAt) >= time.Millisecond)
+}
+
+func TestFake(t *testing.T) {
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	assert.Equal(t, now, fake.Now())
+
+	t.Run("timer", func(t *testing.T) {
+		timer := fake.NewTimer(time.Second)
+		fake.Advance(time.Millisecond * 999)
+		select {
+		case <-timer.C():
+			t.Error("timer fired early")
+		default:
+		}
+
+		fake.Advance(time.Millisecond)
+		assert.Equal(t, now.Add(time.Second), <-timer.C())
+		assert.False(t, timer.Stop())
+		assert.Equal(t, 0, fake.Waiters())
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		timer := fake.NewTimer(time.Second)
+		assert.True(t, timer.Stop())
+		fake.Advance(time.Second)
+		select {
+		case <-timer.C():
+			t.Error("stopped timer fired")
+		default:
+		}
+	})
+
+	t.Run("ticker", func(t *testing.T) {
+		ticker := fake.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for i := 0; i < 3; i++ {
+			fake.Advance(time.Second)
+			<-ticker.C()
+		}
+		assert.Equal(t, 1, fake.Waiters())
+	})
+
+	t.Run("block until", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fake.Sleep(time.Minute)
+		}()
+
+		fake.BlockUntil(1)
+		fake.Advance(time.Minute)
+		<-done
+	})
+
+	t.Run("timers fire in order", func(t *testing.T) {
+		a := fake.NewTimer(time.Second * 2)
+		b := fake.NewTimer(time.Second)
+		start := fake.Now()
+
+		fake.Advance(time.Second * 3)
+		assert.Equal(t, start.Add(time.Second), <-b.C())
+		assert.Equal(t, start.Add(time.Second*2), <-a.C())
+		assert.Equal(t, start.Add(time.Second*3), fake.Now())
+	})
+
+	t.Run("timers and tickers fire in order", func(t *testing.T) {
+		ticker := fake.NewTicker(time.Second)
+		defer ticker.Stop()
+		timer := fake.NewTimer(time.Millisecond * 1500)
+		start := fake.Now()
+
+		fake.Advance(time.Second * 3)
+		assert.Equal(t, start.Add(time.Second), <-ticker.C())
+		assert.Equal(t, start.Add(time.Millisecond*1500), <-timer.C())
+		assert.Equal(t, start.Add(time.Second*3), fake.Now())
+	})
+}
+
+func TestWithTimeout(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	ctx, cancel := clock.WithTimeout(context.Background(), fake, time.Second)
+	defer cancel()
+
+	fake.BlockUntil(1)
+	select {
+	case <-ctx.Done():
+		t.Error("expected context to remain open")
+	default:
+	}
+
+	fake.Advance(time.Second)
+	<-ctx.Done()
+	assert.Equal(t, context.Canceled, ctx.Err())
+}
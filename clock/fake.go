@@ -0,0 +1,228 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type waiter struct {
+	at     time.Time
+	period time.Duration // non-zero for tickers
+	ch     chan time.Time
+	active bool
+}
+
+// Fake is a Clock whose time only moves when Advance or Set is called
+type Fake struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+// NewFake returns a Fake clock set to the time provided
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mutex)
+	return f
+}
+
+// Now implements Clock
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.now
+}
+
+// Since implements Clock
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After implements Clock
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// Sleep implements Clock; blocks until the clock has been advanced by at least d
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// NewTimer implements Clock
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	w := &waiter{ch: make(chan time.Time, 1)}
+	f.schedule(w, d)
+	return &fakeTimer{fake: f, w: w}
+}
+
+// NewTicker implements Clock
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	w := &waiter{ch: make(chan time.Time, 1), period: d}
+	f.schedule(w, d)
+	return &fakeTicker{fake: f, w: w}
+}
+
+// schedule must be called while holding the mutex
+func (f *Fake) schedule(w *waiter, d time.Duration) {
+	w.at = f.now.Add(d)
+	if !w.active {
+		w.active = true
+		f.waiters = append(f.waiters, w)
+	}
+	f.fire()
+	f.cond.Broadcast()
+}
+
+// unschedule must be called while holding the mutex
+func (f *Fake) unschedule(w *waiter) bool {
+	if !w.active {
+		return false
+	}
+
+	w.active = false
+	for i, v := range f.waiters {
+		if v == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			break
+		}
+	}
+	f.cond.Broadcast()
+	return true
+}
+
+// sort orders the waiters by when they come due; must be called while holding the mutex
+func (f *Fake) sort() {
+	sort.SliceStable(f.waiters, func(i, j int) bool {
+		return f.waiters[i].at.Before(f.waiters[j].at)
+	})
+}
+
+// fire delivers to all waiters that are due, leaving the waiters sorted; must be called while
+// holding the mutex
+func (f *Fake) fire() {
+	f.sort()
+
+	remaining := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+
+		select {
+		case w.ch <- f.now:
+		default: // as with time.Ticker, slow receivers miss ticks
+		}
+
+		if w.period > 0 {
+			for !w.at.After(f.now) {
+				w.at = w.at.Add(w.period)
+			}
+			remaining = append(remaining, w)
+			continue
+		}
+		w.active = false
+	}
+	f.waiters = remaining
+	f.sort() // rescheduled tickers may now come due after other waiters
+}
+
+// Advance moves the clock forward by d, firing any timers and tickers that come due
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.set(f.now.Add(d))
+}
+
+// Set moves the clock to t, firing any timers and tickers that come due
+func (f *Fake) Set(t time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.set(t)
+}
+
+// set must be called while holding the mutex; timers are fired in order, with the clock
+// reporting the time each timer came due
+func (f *Fake) set(t time.Time) {
+	for len(f.waiters) > 0 {
+		f.fire()
+		if len(f.waiters) == 0 || f.waiters[0].at.After(t) {
+			break
+		}
+		f.now = f.waiters[0].at
+	}
+	f.now = t
+	f.fire()
+	f.cond.Broadcast()
+}
+
+// Waiters returns the number of timers and tickers currently pending
+func (f *Fake) Waiters() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return len(f.waiters)
+}
+
+// BlockUntil blocks until at least n timers and tickers are pending; allows tests to wait
+// for goroutines to reach the point where they wait on the clock before calling Advance
+func (f *Fake) BlockUntil(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+type fakeTimer struct {
+	fake *Fake
+	w    *waiter
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.w.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.fake.mutex.Lock()
+	defer t.fake.mutex.Unlock()
+
+	return t.fake.unschedule(t.w)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.fake.mutex.Lock()
+	defer t.fake.mutex.Unlock()
+
+	active := t.w.active
+	t.fake.schedule(t.w, d)
+	return active
+}
+
+type fakeTicker struct {
+	fake *Fake
+	w    *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.w.ch }
+
+func (t *fakeTicker) Stop() {
+	t.fake.mutex.Lock()
+	defer t.fake.mutex.Unlock()
+
+	t.fake.unschedule(t.w)
+}
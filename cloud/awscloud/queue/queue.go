@@ -1,11 +1,13 @@
 package queue
 
 import (
+	gocontext "context"
 	"fmt"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/altairsix/pkg/action"
 	"github.com/altairsix/pkg/context"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -71,7 +73,7 @@ func handler(k context.Kontext, h HandleFunc, ch <-chan *Envelope, del chan<- *s
 		case <-k.Context.Done():
 			return
 		case v := <-ch:
-			err := h(k, v.Message)
+			err := safeHandle(k, h, v.Message)
 			if err == nil {
 				del <- v.Message.ReceiptHandle
 			}
@@ -79,6 +81,15 @@ func handler(k context.Kontext, h HandleFunc, ch <-chan *Envelope, del chan<- *s
 	}
 }
 
+// safeHandle invokes the HandleFunc, converting any panic into an *action.PanicError so that a
+// single bad message cannot take down the worker; the message is left on the queue for redelivery
+func safeHandle(k context.Kontext, h HandleFunc, message *sqs.Message) error {
+	a := action.Action(func(ctx gocontext.Context) error {
+		return h(k, message)
+	})
+	return a.Use(action.Recover()).Do(k.Context)
+}
+
 // deleteMessages deletes all the messages contained in the chan, del; returns a signal channel that indicates when
 // all in flight messages have been deleted
 func deleteMessages(sqsApi *sqs.SQS, queueUrl *string, del <-chan *string) <-chan struct{} {
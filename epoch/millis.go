@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/altairsix/pkg/clock"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/pkg/errors"
@@ -39,6 +40,11 @@ func Now() Millis {
 	return Time(time.Now())
 }
 
+// NowFrom returns the current time according to the clock provided
+func NowFrom(c clock.Clock) Millis {
+	return Time(clock.Or(c).Now())
+}
+
 // Resolver provides a resolver usable by github.com/neelance/graphql-go
 //
 //	type Epoch {
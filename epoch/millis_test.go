@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/altairsix/pkg/clock"
 	"github.com/altairsix/pkg/epoch"
 	"github.com/stretchr/testify/assert"
 )
@@ -14,6 +15,15 @@ func TestNow(t *testing.T) {
 	assert.True(t, epoch.Now().Time().Sub(started) < time.Millisecond, "expected now to be the same as time.Now()")
 }
 
+func TestNowFrom(t *testing.T) {
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	assert.Equal(t, epoch.Time(now), epoch.NowFrom(fake))
+
+	fake.Advance(time.Minute)
+	assert.Equal(t, epoch.Time(now.Add(time.Minute)), epoch.NowFrom(fake))
+}
+
 func TestJSON(t *testing.T) {
 	t.Run("obj", func(t *testing.T) {
 		now := epoch.Now()
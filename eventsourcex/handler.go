@@ -2,9 +2,14 @@ package eventsourcex
 
 import (
 	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
 	"time"
 
 	"github.com/altairsix/eventsource"
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/tracer"
 	nats "github.com/nats-io/go-nats"
 	"github.com/opentracing/opentracing-go/log"
 	"github.com/pkg/errors"
@@ -59,6 +64,14 @@ func WithSendNotices(p Processor, nc *nats.Conn, env, boundedContext, source str
 	}
 }
 
+// Acker is implemented by Handlers, such as MessageHandler, that process messages after Receive
+// returns.  Subscriptions use it to commit offsets only once messages have been processed.
+type Acker interface {
+	// OnAck registers fn to be called with the offset of the last message processed each time
+	// processing advances
+	OnAck(fn func(offset uint64))
+}
+
 // Unmarshaler accepts a []byte encoded event and returns an event
 type Unmarshaler func([]byte) (eventsource.Event, error)
 
@@ -90,7 +103,51 @@ type message struct {
 	offset uint64
 }
 
-// MessageHandler encapsulates a nats streaming processor that performs buffered processing
+// Decision determines how the MessageHandler proceeds once messages have failed and retries
+// have been exhausted
+type Decision int
+
+const (
+	// DecisionRetry retries the failed messages; processing does not move past them
+	DecisionRetry Decision = iota
+
+	// DecisionSkip skips the failed messages, advancing the checkpoint past them
+	DecisionSkip
+
+	// DecisionDeadLetter publishes the failed messages to the dead letter Publisher and advances
+	// the checkpoint past them.  Treated as DecisionRetry if no dead letter Publisher was provided.
+	DecisionDeadLetter
+
+	// DecisionStop stops the MessageHandler; Err returns the error
+	DecisionStop
+)
+
+// maxPauseAttempt is an attempt large enough for the backoff to reach its maximum delay
+const maxPauseAttempt = 64
+
+// ErrorFunc is called when messages fail after retries have been exhausted and returns the
+// Decision on how to proceed.  offsets contains the offsets of the failed messages.
+type ErrorFunc func(err error, offsets []uint64) Decision
+
+// DeadLetter is published, as json, in the Data of the record sent to the dead letter Publisher
+type DeadLetter struct {
+	// Offset of the failed message
+	Offset uint64 `json:"offset"`
+
+	// Data contains the original message
+	Data []byte `json:"data"`
+
+	// Err describes why the message failed
+	Err string `json:"err"`
+}
+
+// MessageHandler encapsulates a nats streaming processor that performs buffered processing.
+//
+// When a batch fails, it is retried with backoff.  If it continues to fail, the batch may be
+// bisected to isolate the poison messages.  Failed messages are then dead lettered, skipped,
+// retried, or stop the MessageHandler as decided by the ErrorFunc; the checkpoint never moves
+// past a failed message without a decision.  Messages that fail while the MessageHandler is
+// closing are left, without a decision, for the next run.
 type MessageHandler struct {
 	ctx        context.Context
 	cancel     func()
@@ -102,6 +159,16 @@ type MessageHandler struct {
 	ch         chan *message
 	interval   time.Duration
 	bufferSize int
+	retry      action.Filter
+	retryDelay func(attempt int) time.Duration
+	bisect     bool
+	deadLetter Publisher
+	onError    ErrorFunc
+	workers    int
+	err        error
+
+	mutex sync.Mutex
+	acks  []func(offset uint64)
 }
 
 // MessageHandlerOption allows options to be specified for NewMessageHandler
@@ -122,27 +189,289 @@ func WithInterval(d time.Duration) MessageHandlerOption {
 	}
 }
 
+// WithRetry specifies the backoff used to retry failed batches; defaults to action.Backoff()
+func WithRetry(opts ...action.BackoffOption) MessageHandlerOption {
+	return func(m *MessageHandler) {
+		m.retry = action.Backoff(opts...)
+		m.retryDelay = action.BackoffDelays(opts...)
+	}
+}
+
+// WithBisect splits failed batches in half, recursively, to isolate poison messages so that the
+// remainder of the batch may be processed
+func WithBisect() MessageHandlerOption {
+	return func(m *MessageHandler) {
+		m.bisect = true
+	}
+}
+
+// WithDeadLetter publishes failed messages, with the error attached, to the Publisher provided.
+// Unless an ErrorFunc decides otherwise, failed messages are dead lettered.
+func WithDeadLetter(p Publisher) MessageHandlerOption {
+	return func(m *MessageHandler) {
+		m.deadLetter = p
+	}
+}
+
+// WithWorkers processes each batch using n workers.  Events are sharded across the workers by
+// AggregateID so events for an aggregate are processed in order by a single worker.  The
+// Processor must be safe for concurrent use.  The checkpoint advances only once every worker has
+// finished its portion of the batch.
+func WithWorkers(n int) MessageHandlerOption {
+	return func(m *MessageHandler) {
+		m.workers = n
+	}
+}
+
+// WithErrorFunc specifies the callback that decides how to proceed with failed messages.  By
+// default, failed messages are dead lettered if a dead letter Publisher was provided.  Otherwise
+// messages that failed with a permanent error, see action.Permanent, such as messages that cannot
+// be unmarshaled, stop the MessageHandler and all others are retried.  Messages are only skipped
+// when the ErrorFunc returns DecisionSkip.  Retries are paced by the WithRetry backoff; permanent
+// errors wait the maximum delay between retries.
+func WithErrorFunc(fn ErrorFunc) MessageHandlerOption {
+	return func(m *MessageHandler) {
+		m.onError = fn
+	}
+}
+
 // Done returns a chan that signals when all the resources used by MessageHandler have been released
 func (m *MessageHandler) Done() <-chan struct{} {
 	return m.done
 }
 
-func (m *MessageHandler) flush(data ...*message) error {
-	if len(data) == 0 {
+// Err returns the error that stopped the MessageHandler, if any; valid once Done is closed
+func (m *MessageHandler) Err() error {
+	select {
+	case <-m.done:
+		return m.err
+	default:
 		return nil
 	}
+}
 
+// process processes the messages and, optionally, saves the checkpoint
+func (m *MessageHandler) process(ctx context.Context, checkpoint bool, data ...*message) error {
 	events, sequence, err := bytesToEvents(m.unmarshal, data...)
 	if err != nil {
-		return errors.Wrap(err, "unable to convert []byte to events")
+		return action.Permanent(errors.Wrap(err, "unable to convert []byte to events")) // retrying won't help
 	}
 
-	if err := m.processor.Do(m.ctx, events...); err != nil {
+	if err := m.processor.Do(ctx, events...); err != nil {
 		return errors.Wrap(err, "unable to process events")
 	}
 
-	if err := m.cp.Save(m.ctx, m.cpKey, sequence); err != nil {
-		return errors.Wrapf(err, "unable to save checkpoint, %v %v", m.cpKey, sequence)
+	if !checkpoint {
+		return nil
+	}
+	return m.save(ctx, sequence)
+}
+
+func (m *MessageHandler) save(ctx context.Context, sequence uint64) error {
+	if m.cp != nil {
+		if err := m.cp.Save(ctx, m.cpKey, sequence); err != nil {
+			return errors.Wrapf(err, "unable to save checkpoint, %v %v", m.cpKey, sequence)
+		}
+	}
+
+	m.mutex.Lock()
+	acks := m.acks
+	m.mutex.Unlock()
+
+	for _, fn := range acks {
+		fn(sequence)
+	}
+	return nil
+}
+
+// OnAck implements Acker; fn is called with the offset of the last message processed each time the
+// checkpoint advances, including past skipped and dead lettered messages
+func (m *MessageHandler) OnAck(fn func(offset uint64)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.acks = append(m.acks, fn)
+}
+
+func (m *MessageHandler) flush(data ...*message) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if m.workers > 1 {
+		return m.flushParallel(data...)
+	}
+	return m.handle(m.ctx, true, data...)
+}
+
+// flushParallel shards the messages by aggregate across the workers, preserving the order of
+// events within each aggregate.  The checkpoint is saved only once every worker has finished.
+func (m *MessageHandler) flushParallel(data ...*message) error {
+	segment, ctx := tracer.NewSegment(m.ctx, "message_handler:flush_parallel", log.Int("messages", len(data)))
+	defer segment.Finish()
+
+	shards := make([][]*message, m.workers)
+	for _, item := range data {
+		shard := 0
+		if event, err := m.unmarshal(item.data); err == nil {
+			h := fnv.New32a()
+			h.Write([]byte(event.AggregateID()))
+			shard = int(h.Sum32() % uint32(m.workers))
+		}
+		shards[shard] = append(shards[shard], item)
+	}
+
+	errs := make(chan error, m.workers)
+	for _, shard := range shards {
+		go func(shard []*message) {
+			if len(shard) == 0 {
+				errs <- nil
+				return
+			}
+			errs <- m.handle(ctx, false, shard...)
+		}(shard)
+	}
+
+	var err error
+	for range shards {
+		if v := <-errs; v != nil && err == nil {
+			err = v
+		}
+	}
+	if err != nil {
+		segment.LogFields(log.Error(err))
+		return err
+	}
+
+	return m.save(ctx, data[len(data)-1].offset)
+}
+
+// handle processes the messages, retrying, bisecting and dead lettering as configured
+func (m *MessageHandler) handle(ctx context.Context, checkpoint bool, data ...*message) error {
+	segment, ctx := tracer.NewSegment(ctx, "message_handler:handle", log.Int("messages", len(data)))
+	defer segment.Finish()
+
+	for attempt := 0; ; attempt++ {
+		err := m.retry.AndThen(func(ctx context.Context) error {
+			return m.process(ctx, checkpoint, data...)
+		}).Do(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			// shutting down; failures may be due to the cancellation itself so leave the messages,
+			// without a decision, for the next run
+			segment.Info("message_handler:canceled", log.Error(err))
+			return err
+		}
+
+		if m.bisect && len(data) > 1 {
+			segment.Info("message_handler:bisect", log.Error(err))
+			mid := len(data) / 2
+			if err := m.handle(ctx, checkpoint, data[:mid]...); err != nil {
+				return err
+			}
+			return m.handle(ctx, checkpoint, data[mid:]...)
+		}
+
+		offsets := make([]uint64, 0, len(data))
+		for _, item := range data {
+			offsets = append(offsets, item.offset)
+		}
+
+		decision := DecisionRetry
+		if m.deadLetter != nil {
+			decision = DecisionDeadLetter
+		} else if action.IsPermanent(err) {
+			decision = DecisionStop // retrying won't help and the messages must not be dropped silently
+		}
+		if m.onError != nil {
+			decision = m.onError(err, offsets)
+		}
+		if decision == DecisionDeadLetter && m.deadLetter == nil {
+			decision = DecisionRetry
+		}
+
+		switch decision {
+		case DecisionDeadLetter:
+			segment.Info("message_handler:dead_letter", log.Error(err))
+			if dlErr := m.publishDeadLetters(err, data...); dlErr != nil {
+				segment.LogFields(log.Error(dlErr))
+				if m.pause(ctx, attempt, dlErr) != nil {
+					return dlErr
+				}
+				continue // never move past the messages until they've been dead lettered
+			}
+			if checkpoint {
+				if saveErr := m.save(ctx, data[len(data)-1].offset); saveErr != nil {
+					segment.LogFields(log.Error(saveErr))
+				}
+			}
+			return nil
+
+		case DecisionSkip:
+			segment.Info("message_handler:skip", log.Error(err))
+			if checkpoint {
+				if saveErr := m.save(ctx, data[len(data)-1].offset); saveErr != nil {
+					segment.LogFields(log.Error(saveErr))
+				}
+			}
+			return nil
+
+		case DecisionStop:
+			segment.Info("message_handler:stop", log.Error(err))
+			return err
+
+		default:
+			segment.Info("message_handler:retry", log.Error(err))
+			if m.pause(ctx, attempt, err) != nil {
+				return err // shutting down; leave the messages for the next run
+			}
+		}
+	}
+}
+
+// pause waits before failed messages are attempted again; permanent errors wait the maximum delay
+// as retrying is unlikely to help.  Returns an error if the context is canceled while waiting.
+func (m *MessageHandler) pause(ctx context.Context, attempt int, err error) error {
+	if action.IsPermanent(err) {
+		attempt = maxPauseAttempt
+	}
+
+	t := time.NewTimer(m.retryDelay(attempt))
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (m *MessageHandler) publishDeadLetters(cause error, data ...*message) error {
+	for _, item := range data {
+		payload, err := json.Marshal(DeadLetter{
+			Offset: item.offset,
+			Data:   item.data,
+			Err:    cause.Error(),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "unable to marshal dead letter, %v", item.offset)
+		}
+
+		record := eventsource.StreamRecord{
+			Offset: item.offset,
+			Record: eventsource.Record{Data: payload},
+		}
+		if event, err := m.unmarshal(item.data); err == nil {
+			record.AggregateID = event.AggregateID()
+			record.Version = event.EventVersion()
+		}
+
+		if err := m.deadLetter.Publish(record); err != nil {
+			return errors.Wrapf(err, "unable to publish dead letter, %v", item.offset)
+		}
 	}
 
 	return nil
@@ -150,7 +479,6 @@ func (m *MessageHandler) flush(data ...*message) error {
 
 func (m *MessageHandler) start() {
 	defer close(m.done)
-	defer close(m.ch)
 	defer m.cancel()
 
 	t := time.NewTicker(m.interval)
@@ -160,33 +488,54 @@ func (m *MessageHandler) start() {
 	buffer := make([]*message, size)
 	offset := 0
 
+	flush := func() bool {
+		err := m.flush(buffer[0:offset]...)
+		offset = 0
+		if err != nil {
+			m.err = err
+			return false
+		}
+		return true
+	}
+
 	for {
 		select {
 		case v := <-m.ch:
 			buffer[offset] = v
 			offset++
-			if offset == size {
-				m.flush(buffer[0:offset]...)
-				offset = 0
+			if offset == size && !flush() {
+				return
 			}
 
 		case <-t.C:
-			m.flush(buffer[0:offset]...)
-			offset = 0
+			if !flush() {
+				return
+			}
 
 		case <-m.ctx.Done():
-			m.flush(buffer[0:offset]...)
-			offset = 0
-			return
+			// drain messages already received before the final flush
+			for {
+				select {
+				case v := <-m.ch:
+					buffer[offset] = v
+					offset++
+					if offset == size && !flush() {
+						return
+					}
+				default:
+					flush()
+					return
+				}
+			}
 		}
 	}
 }
 
 // Handle the the specified stream record
 func (m *MessageHandler) Receive(offset uint64, data []byte) {
-	m.ch <- &message{
-		offset: offset,
-		data:   data,
+	select {
+	case m.ch <- &message{offset: offset, data: data}:
+	case <-m.ctx.Done():
 	}
 }
 
@@ -197,7 +546,8 @@ func (m *MessageHandler) Close() error {
 	return nil
 }
 
-// NewMessageHandler constructs a new MessageHandler with the arguments provided
+// NewMessageHandler constructs a new MessageHandler with the arguments provided.  cp may be nil if
+// the checkpoint is instead saved by the subscription via OnAck.
 func NewMessageHandler(ctx context.Context, p Processor, u Unmarshaler, cp Checkpointer, cpKey string, opts ...MessageHandlerOption) *MessageHandler {
 	child, cancel := context.WithCancel(ctx)
 
@@ -208,9 +558,12 @@ func NewMessageHandler(ctx context.Context, p Processor, u Unmarshaler, cp Check
 		processor:  p,
 		unmarshal:  u,
 		cp:         cp,
+		cpKey:      cpKey,
 		ch:         make(chan *message, 256),
 		interval:   time.Millisecond * 250,
 		bufferSize: 100,
+		retry:      action.Backoff(),
+		retryDelay: action.BackoffDelays(),
 	}
 
 	for _, opt := range opts {
@@ -2,12 +2,21 @@ package eventsourcex_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/altairsix/eventsource"
+	"github.com/altairsix/pkg/action"
 	"github.com/altairsix/pkg/eventsourcex"
 	"github.com/nats-io/go-nats"
+	"github.com/pkg/errors"
 	"github.com/savaki/randx"
 	"github.com/stretchr/testify/assert"
 )
@@ -140,6 +149,289 @@ func TestMessageHandler(t *testing.T) {
 	})
 }
 
+type deadLetters struct {
+	mutex   sync.Mutex
+	records []eventsource.StreamRecord
+}
+
+func (d *deadLetters) Publish(record eventsource.StreamRecord) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.records = append(d.records, record)
+	return nil
+}
+
+func TestMessageHandlerErrors(t *testing.T) {
+	// messages contain the aggregate id; "bad" is a poison message
+	u := func(data []byte) (eventsource.Event, error) {
+		return eventsource.Model{ID: string(data)}, nil
+	}
+
+	var mutex sync.Mutex
+	var processed []string
+	p := func(ctx context.Context, events ...eventsource.Event) error {
+		for _, event := range events {
+			if event.AggregateID() == "bad" {
+				return io.ErrUnexpectedEOF
+			}
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, event := range events {
+			processed = append(processed, event.AggregateID())
+		}
+		return nil
+	}
+
+	retry := eventsourcex.WithRetry(action.WithMaxAttempts(2), action.WithInitialDelay(time.Millisecond))
+
+	t.Run("bisect and dead letter", func(t *testing.T) {
+		processed = nil
+		cp := &MockCP{}
+		dl := &deadLetters{}
+		h := eventsourcex.NewMessageHandler(context.Background(), p, u, cp, "key",
+			eventsourcex.WithBufferSize(4),
+			eventsourcex.WithInterval(time.Minute),
+			eventsourcex.WithBisect(),
+			eventsourcex.WithDeadLetter(dl),
+			retry,
+		)
+
+		acks := make(chan uint64, 4)
+		h.OnAck(func(offset uint64) { acks <- offset })
+
+		for i, id := range []string{"a", "b", "bad", "c"} {
+			h.Receive(uint64(i+1), []byte(id))
+		}
+		for offset := uint64(0); offset < 4; {
+			offset = <-acks
+		}
+		assert.Nil(t, h.Close())
+		assert.Nil(t, h.Err())
+
+		assert.Equal(t, []string{"a", "b", "c"}, processed)
+		assert.Equal(t, "key", cp.saveKey)
+		assert.Equal(t, uint64(4), cp.saveSequence)
+
+		assert.Len(t, dl.records, 1)
+		assert.Equal(t, uint64(3), dl.records[0].Offset)
+		assert.Equal(t, "bad", dl.records[0].AggregateID)
+
+		letter := eventsourcex.DeadLetter{}
+		assert.Nil(t, json.Unmarshal(dl.records[0].Data, &letter))
+		assert.Equal(t, []byte("bad"), letter.Data)
+		assert.Contains(t, letter.Err, io.ErrUnexpectedEOF.Error())
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		cp := &MockCP{}
+		var failed []uint64
+		h := eventsourcex.NewMessageHandler(context.Background(), p, u, cp, "key",
+			eventsourcex.WithBufferSize(2),
+			eventsourcex.WithErrorFunc(func(err error, offsets []uint64) eventsourcex.Decision {
+				failed = offsets
+				return eventsourcex.DecisionStop
+			}),
+			retry,
+		)
+
+		h.Receive(1, []byte("a"))
+		h.Receive(2, []byte("bad"))
+		<-h.Done()
+
+		assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(h.Err()))
+		assert.Equal(t, []uint64{1, 2}, failed)
+		assert.Equal(t, 0, cp.saveCalled, "checkpoint must not move past failed messages")
+
+		h.Receive(3, []byte("c")) // must not block or panic once stopped
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		cp := &MockCP{}
+		h := eventsourcex.NewMessageHandler(context.Background(), p, u, cp, "key",
+			eventsourcex.WithBufferSize(1),
+			eventsourcex.WithErrorFunc(func(err error, offsets []uint64) eventsourcex.Decision {
+				return eventsourcex.DecisionSkip
+			}),
+			retry,
+		)
+
+		acks := make(chan uint64, 1)
+		h.OnAck(func(offset uint64) { acks <- offset })
+
+		h.Receive(1, []byte("bad"))
+		assert.Equal(t, uint64(1), <-acks)
+		assert.Nil(t, h.Close())
+		assert.Equal(t, uint64(1), cp.saveSequence)
+	})
+}
+
+func TestMessageHandlerRetryPacing(t *testing.T) {
+	// "poison" cannot be unmarshaled, a permanent error
+	u := func(data []byte) (eventsource.Event, error) {
+		if string(data) == "poison" {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return eventsource.Model{ID: string(data)}, nil
+	}
+	p := func(ctx context.Context, events ...eventsource.Event) error {
+		return nil
+	}
+	retry := eventsourcex.WithRetry(
+		action.WithMaxAttempts(1),
+		action.WithInitialDelay(time.Millisecond*10),
+		action.WithMaxDelay(time.Millisecond*20),
+		action.WithJitter(action.JitterNone),
+	)
+
+	t.Run("permanent errors stop by default", func(t *testing.T) {
+		cp := &MockCP{}
+		h := eventsourcex.NewMessageHandler(context.Background(), p, u, cp, "key", eventsourcex.WithBufferSize(1), retry)
+		h.Receive(1, []byte("poison"))
+		<-h.Done()
+
+		assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(h.Err()))
+		assert.Equal(t, 0, cp.saveCalled, "checkpoint must not move past failed messages")
+	})
+
+	t.Run("retries bounded", func(t *testing.T) {
+		calls := int32(0)
+		h := eventsourcex.NewMessageHandler(context.Background(), p, u, &MockCP{}, "key",
+			eventsourcex.WithBufferSize(1),
+			eventsourcex.WithErrorFunc(func(err error, offsets []uint64) eventsourcex.Decision {
+				atomic.AddInt32(&calls, 1)
+				return eventsourcex.DecisionRetry
+			}),
+			retry,
+		)
+		h.Receive(1, []byte("poison"))
+		time.Sleep(time.Millisecond * 200)
+		assert.Nil(t, h.Close())
+
+		// permanent errors wait the max delay, 20ms, between decisions
+		n := atomic.LoadInt32(&calls)
+		assert.True(t, n >= 1 && n <= 12, "expected retries to be paced; got %v calls", n)
+	})
+
+	t.Run("failed dead letters bounded", func(t *testing.T) {
+		calls := int32(0)
+		dl := eventsourcex.PublisherFunc(func(record eventsource.StreamRecord) error {
+			atomic.AddInt32(&calls, 1)
+			return io.EOF
+		})
+		h := eventsourcex.NewMessageHandler(context.Background(), p, u, &MockCP{}, "key",
+			eventsourcex.WithBufferSize(1),
+			eventsourcex.WithDeadLetter(dl),
+			retry,
+		)
+		h.Receive(1, []byte("poison"))
+		time.Sleep(time.Millisecond * 200)
+		assert.Nil(t, h.Close())
+
+		n := atomic.LoadInt32(&calls)
+		assert.True(t, n >= 1 && n <= 22, "expected dead letter attempts to be paced; got %v calls", n)
+	})
+}
+
+func TestMessageHandlerCloseMidBatch(t *testing.T) {
+	u := func(data []byte) (eventsource.Event, error) { return eventsource.Model{}, nil }
+	p := func(ctx context.Context, events ...eventsource.Event) error { return ctx.Err() }
+
+	cp := &MockCP{}
+	dl := &deadLetters{}
+	h := eventsourcex.NewMessageHandler(context.Background(), p, u, cp, "key",
+		eventsourcex.WithBufferSize(10),
+		eventsourcex.WithInterval(time.Minute),
+		eventsourcex.WithDeadLetter(dl),
+		eventsourcex.WithRetry(action.WithMaxAttempts(2), action.WithInitialDelay(time.Millisecond)),
+	)
+
+	for i := 1; i <= 5; i++ {
+		h.Receive(uint64(i), nil)
+	}
+	assert.Nil(t, h.Close())
+
+	assert.Len(t, dl.records, 0, "in flight messages must not be dead lettered at shutdown")
+	assert.Equal(t, 0, cp.saveCalled, "checkpoint must not move past unprocessed messages")
+}
+
+func TestMessageHandlerWorkers(t *testing.T) {
+	// messages contain aggregate id:version
+	u := func(data []byte) (eventsource.Event, error) {
+		parts := strings.Split(string(data), ":")
+		version, _ := strconv.Atoi(parts[1])
+		return eventsource.Model{ID: parts[0], Version: version}, nil
+	}
+
+	var mutex sync.Mutex
+	versions := map[string][]int{}
+	running, maxRunning := int32(0), int32(0)
+	p := func(ctx context.Context, events ...eventsource.Event) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		mutex.Lock()
+		if n > maxRunning {
+			maxRunning = n
+		}
+		for _, event := range events {
+			versions[event.AggregateID()] = append(versions[event.AggregateID()], event.EventVersion())
+		}
+		mutex.Unlock()
+
+		time.Sleep(time.Millisecond * 10)
+		return nil
+	}
+
+	cp := &MockCP{}
+	h := eventsourcex.NewMessageHandler(context.Background(), p, u, cp, "key",
+		eventsourcex.WithBufferSize(40),
+		eventsourcex.WithWorkers(4),
+	)
+
+	offset := uint64(0)
+	for version := 1; version <= 5; version++ {
+		for i := 0; i < 8; i++ {
+			offset++
+			h.Receive(offset, []byte(fmt.Sprintf("id-%v:%v", i, version)))
+		}
+	}
+	assert.Nil(t, h.Close())
+
+	assert.True(t, maxRunning > 1, "expected workers to run concurrently")
+	assert.Len(t, versions, 8)
+	for id, v := range versions {
+		assert.Equal(t, []int{1, 2, 3, 4, 5}, v, "expected events for aggregate, %v, in order", id)
+	}
+	assert.Equal(t, offset, cp.saveSequence)
+}
+
+func TestMessageHandlerOnAck(t *testing.T) {
+	p := func(ctx context.Context, events ...eventsource.Event) error { return nil }
+	u := func(data []byte) (eventsource.Event, error) { return eventsource.Model{}, nil }
+
+	// cp may be nil when the subscription saves the checkpoint from the acks
+	h := eventsourcex.NewMessageHandler(context.Background(), p, u, nil, "key", eventsourcex.WithBufferSize(2))
+
+	acks := make(chan uint64, 2)
+	h.OnAck(func(offset uint64) { acks <- offset })
+
+	h.Receive(1, nil)
+	select {
+	case <-acks:
+		t.Fatal("expected no ack before the message was processed")
+	default:
+	}
+
+	h.Receive(2, nil)
+	h.Receive(3, nil)
+	assert.Nil(t, h.Close())
+
+	assert.Equal(t, uint64(2), <-acks)
+	assert.Equal(t, uint64(3), <-acks)
+}
+
 func TestWithSendNotices(t *testing.T) {
 	nc, err := nats.Connect(nats.DefaultURL)
 	assert.Nil(t, err)
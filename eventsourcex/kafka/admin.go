@@ -0,0 +1,264 @@
+package kafka
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+)
+
+// Cleanup policies supported by kafka topics
+const (
+	CleanupDelete        = "delete"
+	CleanupCompact       = "compact"
+	CleanupCompactDelete = "compact,delete"
+)
+
+// Topic config names managed by TopicSpec
+const (
+	ConfigRetention     = "retention.ms"
+	ConfigCleanupPolicy = "cleanup.policy"
+)
+
+// TopicSpec describes the desired state of a topic
+type TopicSpec struct {
+	// Name of the topic e.g. from MakeTopicName
+	Name string
+
+	// Partitions and ReplicationFactor of the topic
+	Partitions        int32
+	ReplicationFactor int16
+
+	// Retention of messages; 0 uses the broker default, negative retains messages forever
+	Retention time.Duration
+
+	// CleanupPolicy of the topic e.g. CleanupCompact; "" uses the broker default
+	CleanupPolicy string
+
+	// Configs contains additional topic level configs e.g. min.insync.replicas
+	Configs map[string]string
+}
+
+// configs returns the topic level configs implied by the spec
+func (t TopicSpec) configs() map[string]string {
+	configs := map[string]string{}
+	for k, v := range t.Configs {
+		configs[k] = v
+	}
+	switch {
+	case t.Retention < 0:
+		configs[ConfigRetention] = "-1"
+	case t.Retention > 0:
+		configs[ConfigRetention] = strconv.FormatInt(int64(t.Retention/time.Millisecond), 10)
+	}
+	if t.CleanupPolicy != "" {
+		configs[ConfigCleanupPolicy] = t.CleanupPolicy
+	}
+	return configs
+}
+
+// Drift describes a setting of an existing topic that differs from its TopicSpec
+type Drift struct {
+	Topic    string
+	Setting  string
+	Expected string
+	Actual   string
+}
+
+// String implements fmt.Stringer
+func (d Drift) String() string {
+	return fmt.Sprintf("%v: %v expected %v, actual %v", d.Topic, d.Setting, d.Expected, d.Actual)
+}
+
+// Controller contains the subset of *sarama.Broker used to administer topics; requests should be sent
+// to the controller of the cluster, see sarama.Client.Controller
+type Controller interface {
+	GetMetadata(request *sarama.MetadataRequest) (*sarama.MetadataResponse, error)
+	CreateTopics(request *sarama.CreateTopicsRequest) (*sarama.CreateTopicsResponse, error)
+	DescribeConfigs(request *sarama.DescribeConfigsRequest) (*sarama.DescribeConfigsResponse, error)
+}
+
+// AdminClient creates a kafka client suitable for administering topics
+//
+//	client, err := kafka.AdminClient(kafka.EnvConfig())
+//	...
+//	controller, err := client.Controller()
+//	...
+//	drift, err := kafka.EnsureTopics(os.Stdout, controller, specs...)
+func AdminClient(cfg *Config, opts ...Option) (sarama.Client, error) {
+	config := sarama.NewConfig()
+	if err := cfg.Apply(config); err != nil {
+		return nil, err
+	}
+
+	if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		config.Version = sarama.V0_11_0_0 // required to describe configs
+	}
+
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	client, err := sarama.NewClient(cfg.BrokerList, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create kafka admin client")
+	}
+
+	return client, nil
+}
+
+// EnsureTopics creates the topics that do not yet exist and reports how existing topics have drifted
+// from their spec.  Existing topics are never modified.  Progress is written to w.
+func EnsureTopics(w io.Writer, controller Controller, specs ...TopicSpec) ([]Drift, error) {
+	details := map[string]*sarama.TopicDetail{}
+	for _, spec := range specs {
+		entries := map[string]*string{}
+		for k, v := range spec.configs() {
+			v := v
+			entries[k] = &v
+		}
+		details[spec.Name] = &sarama.TopicDetail{
+			NumPartitions:     spec.Partitions,
+			ReplicationFactor: spec.ReplicationFactor,
+			ConfigEntries:     entries,
+		}
+	}
+
+	resp, err := controller.CreateTopics(&sarama.CreateTopicsRequest{
+		TopicDetails: details,
+		Timeout:      time.Second * 30,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create topics")
+	}
+
+	var existing []TopicSpec
+	for _, spec := range specs {
+		fmt.Fprintf(w, "creating topic, %v ... ", spec.Name)
+
+		topicErr, ok := resp.TopicErrors[spec.Name]
+		switch {
+		case !ok || topicErr.Err == sarama.ErrNoError:
+			fmt.Fprintln(w, "ok")
+		case topicErr.Err == sarama.ErrTopicAlreadyExists:
+			fmt.Fprintln(w, "exists, checking for drift")
+			existing = append(existing, spec)
+		default:
+			fmt.Fprintf(w, "failed, %v\n", topicErr.Err)
+			return nil, errors.Wrapf(topicErr.Err, "unable to create topic, %v", spec.Name)
+		}
+	}
+
+	if len(existing) == 0 {
+		return nil, nil
+	}
+
+	drift, err := findDrift(controller, existing)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range drift {
+		fmt.Fprintf(w, "drift, %v\n", d)
+	}
+
+	return drift, nil
+}
+
+// findDrift compares existing topics against their specs
+func findDrift(controller Controller, specs []TopicSpec) ([]Drift, error) {
+	names := make([]string, 0, len(specs))
+	resources := make([]*sarama.ConfigResource, 0, len(specs))
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+
+		var configNames []string
+		for k := range spec.configs() {
+			configNames = append(configNames, k)
+		}
+		resources = append(resources, &sarama.ConfigResource{
+			Type:        sarama.TopicResource,
+			Name:        spec.Name,
+			ConfigNames: configNames,
+		})
+	}
+
+	metadata, err := controller.GetMetadata(&sarama.MetadataRequest{Version: 1, Topics: names})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to describe topics")
+	}
+	topics := map[string]*sarama.TopicMetadata{}
+	for _, topic := range metadata.Topics {
+		if topic.Err != sarama.ErrNoError {
+			return nil, errors.Wrapf(topic.Err, "unable to describe topic, %v", topic.Name)
+		}
+		topics[topic.Name] = topic
+	}
+
+	described, err := controller.DescribeConfigs(&sarama.DescribeConfigsRequest{Resources: resources})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to describe topic configs")
+	}
+	configs := map[string]map[string]string{}
+	for _, resource := range described.Resources {
+		if resource.ErrorCode != 0 {
+			return nil, errors.Wrapf(sarama.KError(resource.ErrorCode), "unable to describe configs for topic, %v: %v", resource.Name, resource.ErrorMsg)
+		}
+		values := map[string]string{}
+		for _, entry := range resource.Configs {
+			values[entry.Name] = entry.Value
+		}
+		configs[resource.Name] = values
+	}
+
+	var drift []Drift
+	for _, spec := range specs {
+		topic, ok := topics[spec.Name]
+		if !ok {
+			return nil, errors.Errorf("topic, %v, not found", spec.Name)
+		}
+
+		if actual := int32(len(topic.Partitions)); spec.Partitions > 0 && actual != spec.Partitions {
+			drift = append(drift, Drift{
+				Topic:    spec.Name,
+				Setting:  "partitions",
+				Expected: strconv.Itoa(int(spec.Partitions)),
+				Actual:   strconv.Itoa(int(actual)),
+			})
+		}
+
+		if len(topic.Partitions) > 0 {
+			if actual := int16(len(topic.Partitions[0].Replicas)); spec.ReplicationFactor > 0 && actual != spec.ReplicationFactor {
+				drift = append(drift, Drift{
+					Topic:    spec.Name,
+					Setting:  "replication-factor",
+					Expected: strconv.Itoa(int(spec.ReplicationFactor)),
+					Actual:   strconv.Itoa(int(actual)),
+				})
+			}
+		}
+
+		expected := spec.configs()
+		keys := make([]string, 0, len(expected))
+		for k := range expected {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if actual := configs[spec.Name][k]; actual != expected[k] {
+				drift = append(drift, Drift{
+					Topic:    spec.Name,
+					Setting:  k,
+					Expected: expected[k],
+					Actual:   actual,
+				})
+			}
+		}
+	}
+
+	return drift, nil
+}
@@ -0,0 +1,123 @@
+package kafka_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/altairsix/pkg/eventsourcex/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockController struct {
+	created  map[string]*sarama.TopicDetail
+	existing map[string]*sarama.TopicDetail
+	err      error
+}
+
+func (m *MockController) CreateTopics(request *sarama.CreateTopicsRequest) (*sarama.CreateTopicsResponse, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	resp := &sarama.CreateTopicsResponse{TopicErrors: map[string]*sarama.TopicError{}}
+	for name, detail := range request.TopicDetails {
+		if _, ok := m.existing[name]; ok {
+			resp.TopicErrors[name] = &sarama.TopicError{Err: sarama.ErrTopicAlreadyExists}
+			continue
+		}
+		m.created[name] = detail
+		resp.TopicErrors[name] = &sarama.TopicError{Err: sarama.ErrNoError}
+	}
+	return resp, nil
+}
+
+func (m *MockController) GetMetadata(request *sarama.MetadataRequest) (*sarama.MetadataResponse, error) {
+	resp := &sarama.MetadataResponse{}
+	for _, name := range request.Topics {
+		detail := m.existing[name]
+		topic := &sarama.TopicMetadata{Name: name}
+		for i := int32(0); i < detail.NumPartitions; i++ {
+			topic.Partitions = append(topic.Partitions, &sarama.PartitionMetadata{
+				ID:       i,
+				Replicas: make([]int32, detail.ReplicationFactor),
+			})
+		}
+		resp.Topics = append(resp.Topics, topic)
+	}
+	return resp, nil
+}
+
+func (m *MockController) DescribeConfigs(request *sarama.DescribeConfigsRequest) (*sarama.DescribeConfigsResponse, error) {
+	resp := &sarama.DescribeConfigsResponse{}
+	for _, resource := range request.Resources {
+		rr := &sarama.ResourceResponse{Type: resource.Type, Name: resource.Name}
+		for _, name := range resource.ConfigNames {
+			value := "broker-default"
+			if v, ok := m.existing[resource.Name].ConfigEntries[name]; ok {
+				value = *v
+			}
+			rr.Configs = append(rr.Configs, &sarama.ConfigEntry{Name: name, Value: value})
+		}
+		resp.Resources = append(resp.Resources, rr)
+	}
+	return resp, nil
+}
+
+func str(s string) *string { return &s }
+
+func TestEnsureTopics(t *testing.T) {
+	controller := &MockController{
+		created: map[string]*sarama.TopicDetail{},
+		existing: map[string]*sarama.TopicDetail{
+			"existing": {
+				NumPartitions:     3,
+				ReplicationFactor: 3,
+				ConfigEntries:     map[string]*string{kafka.ConfigCleanupPolicy: str(kafka.CleanupCompact)},
+			},
+		},
+	}
+
+	w := &bytes.Buffer{}
+	drift, err := kafka.EnsureTopics(w, controller,
+		kafka.TopicSpec{
+			Name:              "new",
+			Partitions:        6,
+			ReplicationFactor: 3,
+			Retention:         time.Hour,
+			CleanupPolicy:     kafka.CleanupDelete,
+		},
+		kafka.TopicSpec{
+			Name:              "existing",
+			Partitions:        6,
+			ReplicationFactor: 3,
+			Retention:         -1,
+			CleanupPolicy:     kafka.CleanupCompact,
+		},
+	)
+	assert.Nil(t, err)
+
+	created := controller.created["new"]
+	assert.NotNil(t, created)
+	assert.Equal(t, int32(6), created.NumPartitions)
+	assert.Equal(t, "3600000", *created.ConfigEntries[kafka.ConfigRetention])
+	assert.Equal(t, kafka.CleanupDelete, *created.ConfigEntries[kafka.ConfigCleanupPolicy])
+
+	assert.Equal(t, []kafka.Drift{
+		{Topic: "existing", Setting: "partitions", Expected: "6", Actual: "3"},
+		{Topic: "existing", Setting: kafka.ConfigRetention, Expected: "-1", Actual: "broker-default"},
+	}, drift)
+
+	output := w.String()
+	assert.Contains(t, output, "creating topic, new ... ok")
+	assert.Contains(t, output, "creating topic, existing ... exists")
+	assert.Contains(t, output, "drift, existing: partitions expected 6, actual 3")
+}
+
+func TestEnsureTopicsErr(t *testing.T) {
+	controller := &MockController{err: io.ErrUnexpectedEOF}
+	_, err := kafka.EnsureTopics(&bytes.Buffer{}, controller, kafka.TopicSpec{Name: "topic"})
+	assert.NotNil(t, err)
+}
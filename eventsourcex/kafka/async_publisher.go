@@ -0,0 +1,269 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/altairsix/eventsource"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+)
+
+// Header keys attached to each message by AsyncPublisher
+const (
+	HeaderAggregateID = "aggregate-id"
+	HeaderVersion     = "version"
+	HeaderOffset      = "offset"
+	HeaderEventType   = "event-type"
+
+	// HeaderBaggagePrefix prefixes the trace baggage items carried by each message
+	HeaderBaggagePrefix = "ot-baggage-"
+)
+
+// ErrPublisherClosed is returned when publishing to an AsyncPublisher that has been closed
+var ErrPublisherClosed = errors.New("kafka publisher closed")
+
+// PublisherOption provides functional options to NewAsyncPublisher
+type PublisherOption func(*AsyncPublisher)
+
+// WithEventType derives the event type header from the record; records for which fn returns ""
+// carry no event type header
+func WithEventType(fn func(record eventsource.StreamRecord) string) PublisherOption {
+	return func(p *AsyncPublisher) {
+		p.eventType = fn
+	}
+}
+
+// AsyncPublisher publishes records through a sarama.AsyncProducer; messages are batched by the
+// producer according to its Producer.Flush settings, see AsyncProducer, WithLinger and WithBatchSize.
+// Each message is keyed by aggregate id and carries the aggregate id, version, offset, event type
+// and trace context of the caller as headers; use PublishContext or PublishBatchContext to carry a
+// trace context.  AsyncPublisher implements eventsourcex.ContextPublisher and
+// eventsourcex.BatchContextPublisher so the stream supervisor passes along its trace context.
+type AsyncPublisher struct {
+	producer  sarama.AsyncProducer
+	topic     string
+	eventType func(record eventsource.StreamRecord) string
+	segment   tracer.Segment
+
+	mutex   sync.Mutex
+	idle    *sync.Cond // signaled when pending reaches 0
+	closed  bool
+	pending int
+	done    chan struct{}
+}
+
+// NewAsyncPublisher returns a publisher for the topic provided.  The producer must return both
+// successes and errors, as producers created by AsyncProducer do; otherwise Publish will never
+// return.  The publisher owns the producer and closes it on Close.
+func NewAsyncPublisher(ctx context.Context, producer sarama.AsyncProducer, topic string, opts ...PublisherOption) *AsyncPublisher {
+	segment, _ := tracer.NewSegment(ctx, "kafka:async_publisher", log.String("topic", topic))
+
+	p := &AsyncPublisher{
+		producer: producer,
+		topic:    topic,
+		segment:  segment,
+		done:     make(chan struct{}),
+	}
+	p.idle = sync.NewCond(&p.mutex)
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	go p.dispatch()
+
+	return p
+}
+
+// traceHeaders returns the headers carrying the trace context of the span within ctx
+func traceHeaders(ctx context.Context) []sarama.RecordHeader {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+
+	carrier := opentracing.TextMapCarrier{}
+	func() {
+		defer func() { recover() }() // not every tracer supports Inject
+		span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier)
+	}()
+	span.Context().ForeachBaggageItem(func(k, v string) bool {
+		carrier[HeaderBaggagePrefix+k] = v
+		return true
+	})
+
+	var headers []sarama.RecordHeader
+	for k, v := range carrier {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return headers
+}
+
+// dispatch delivers the producer's reports to the callers awaiting them
+func (p *AsyncPublisher) dispatch() {
+	defer close(p.done)
+	defer p.segment.Finish()
+
+	report := func(message *sarama.ProducerMessage, err error) {
+		if ch, ok := message.Metadata.(chan error); ok {
+			ch <- err
+			p.release()
+		}
+	}
+
+	successes, errs := p.producer.Successes(), p.producer.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case message, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			report(message, nil)
+
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			p.segment.LogFields(log.Error(err.Err), log.String("text", "unable to publish record"))
+			report(err.Msg, err.Err)
+		}
+	}
+}
+
+func (p *AsyncPublisher) message(record eventsource.StreamRecord, trace []sarama.RecordHeader, ch chan error) *sarama.ProducerMessage {
+	headers := make([]sarama.RecordHeader, 0, len(trace)+4)
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderAggregateID), Value: []byte(record.AggregateID)},
+		sarama.RecordHeader{Key: []byte(HeaderVersion), Value: []byte(strconv.Itoa(record.Version))},
+		sarama.RecordHeader{Key: []byte(HeaderOffset), Value: []byte(strconv.FormatUint(record.Offset, 10))},
+	)
+	if p.eventType != nil {
+		if v := p.eventType(record); v != "" {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(HeaderEventType), Value: []byte(v)})
+		}
+	}
+	headers = append(headers, trace...)
+
+	return &sarama.ProducerMessage{
+		Topic:    p.topic,
+		Key:      sarama.StringEncoder(record.AggregateID),
+		Value:    sarama.ByteEncoder(record.Data),
+		Headers:  headers,
+		Metadata: ch,
+	}
+}
+
+// PublishAsync queues the record for publishing with the trace context of ctx; the channel returned
+// receives nil once the record has been acknowledged by kafka or the error that prevented it
+func (p *AsyncPublisher) PublishAsync(ctx context.Context, record eventsource.StreamRecord) <-chan error {
+	return p.publishAsync(record, traceHeaders(ctx))
+}
+
+func (p *AsyncPublisher) publishAsync(record eventsource.StreamRecord, trace []sarama.RecordHeader) <-chan error {
+	ch := make(chan error, 1)
+
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		ch <- ErrPublisherClosed
+		return ch
+	}
+	p.pending++ // Close waits for pending records before closing the producer
+	p.mutex.Unlock()
+
+	// send without holding the lock; the producer may apply back pressure and Close must not wait
+	// on it to reject further records
+	p.producer.Input() <- p.message(record, trace, ch)
+	return ch
+}
+
+// Publish publishes the record and waits for it to be acknowledged; implements eventsourcex.Publisher.
+// The message carries no trace context, see PublishContext.
+func (p *AsyncPublisher) Publish(record eventsource.StreamRecord) error {
+	return p.PublishContext(context.Background(), record)
+}
+
+// PublishContext publishes the record with the trace context of ctx and waits for it to be
+// acknowledged
+func (p *AsyncPublisher) PublishContext(ctx context.Context, record eventsource.StreamRecord) error {
+	return <-p.PublishAsync(ctx, record)
+}
+
+// PublishBatch publishes the records together and waits for all of them to be acknowledged;
+// implements eventsourcex.BatchPublisher.  The messages carry no trace context, see
+// PublishBatchContext.
+func (p *AsyncPublisher) PublishBatch(records []eventsource.StreamRecord) error {
+	return p.PublishBatchContext(context.Background(), records)
+}
+
+// PublishBatchContext publishes the records together with the trace context of ctx and waits for
+// all of them to be acknowledged; returns the error for the first record that could not be
+// published.  Records following a failed record may still have been published.
+func (p *AsyncPublisher) PublishBatchContext(ctx context.Context, records []eventsource.StreamRecord) error {
+	trace := traceHeaders(ctx)
+
+	reports := make([]<-chan error, 0, len(records))
+	for _, record := range records {
+		reports = append(reports, p.publishAsync(record, trace))
+	}
+
+	var err error
+	for i, ch := range reports {
+		if v := <-ch; v != nil && err == nil {
+			err = errors.Wrapf(v, "unable to publish record at offset, %v", records[i].Offset)
+		}
+	}
+	return err
+}
+
+// release records that a pending record has been acknowledged or failed
+func (p *AsyncPublisher) release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.pending--
+	if p.pending == 0 {
+		p.idle.Broadcast()
+	}
+}
+
+// waitIdle waits until no records are pending; p.mutex must be held
+func (p *AsyncPublisher) waitIdle() {
+	for p.pending > 0 {
+		p.idle.Wait()
+	}
+}
+
+// Flush waits until no records are pending, each having been acknowledged or failed.  Records
+// published while Flush waits are waited for as well.
+func (p *AsyncPublisher) Flush() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.waitIdle()
+}
+
+// Close stops accepting records, waits for the records already accepted to be delivered and closes
+// the producer.  Records published once Close has been called fail with ErrPublisherClosed.
+func (p *AsyncPublisher) Close() error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		<-p.done
+		return nil
+	}
+	p.closed = true
+	p.waitIdle()
+	p.mutex.Unlock()
+
+	p.producer.AsyncClose()
+	<-p.done
+
+	return nil
+}
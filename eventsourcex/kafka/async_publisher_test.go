@@ -0,0 +1,221 @@
+package kafka_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/altairsix/eventsource"
+	"github.com/altairsix/pkg/eventsourcex"
+	"github.com/altairsix/pkg/eventsourcex/kafka"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAsyncProducer(t *testing.T) *mocks.AsyncProducer {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	return mocks.NewAsyncProducer(t, config)
+}
+
+func TestAsyncPublisher(t *testing.T) {
+	record := eventsource.StreamRecord{
+		Record:      eventsource.Record{Version: 3, Data: []byte("data")},
+		Offset:      42,
+		AggregateID: "abc",
+	}
+
+	producer := newAsyncProducer(t)
+	producer.ExpectInputWithCheckerFunctionAndSucceed(func(value []byte) error {
+		assert.Equal(t, record.Data, value)
+		return nil
+	})
+	producer.ExpectInputAndFail(io.ErrUnexpectedEOF)
+
+	p := kafka.NewAsyncPublisher(context.Background(), producer, "topic", kafka.WithEventType(func(eventsource.StreamRecord) string {
+		return "Created"
+	}))
+
+	var _ eventsourcex.Publisher = p
+	var _ eventsourcex.BatchPublisher = p
+
+	assert.Nil(t, p.Publish(record))
+	assert.Equal(t, io.ErrUnexpectedEOF, p.Publish(record))
+
+	assert.Nil(t, p.Close())
+	assert.Equal(t, kafka.ErrPublisherClosed, p.Publish(record))
+}
+
+// recordingProducer acknowledges every message, recording it; the producer accepts no messages
+// until hold, if provided, is closed
+type recordingProducer struct {
+	sarama.AsyncProducer
+
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+	messages  []*sarama.ProducerMessage
+}
+
+func newRecordingProducer() *recordingProducer {
+	return newHeldProducer(nil)
+}
+
+func newHeldProducer(hold <-chan struct{}) *recordingProducer {
+	p := &recordingProducer{
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+	}
+	go func() {
+		defer close(p.errors)
+		defer close(p.successes)
+		if hold != nil {
+			<-hold
+		}
+		for message := range p.input {
+			p.messages = append(p.messages, message)
+			p.successes <- message
+		}
+	}()
+	return p
+}
+
+func (p *recordingProducer) Input() chan<- *sarama.ProducerMessage     { return p.input }
+func (p *recordingProducer) Successes() <-chan *sarama.ProducerMessage { return p.successes }
+func (p *recordingProducer) Errors() <-chan *sarama.ProducerError      { return p.errors }
+func (p *recordingProducer) AsyncClose()                               { close(p.input) }
+
+func TestAsyncPublisherHeaders(t *testing.T) {
+	producer := newRecordingProducer()
+	p := kafka.NewAsyncPublisher(context.Background(), producer, "topic", kafka.WithEventType(func(eventsource.StreamRecord) string {
+		return "Created"
+	}))
+
+	err := <-p.PublishAsync(context.Background(), eventsource.StreamRecord{
+		Record:      eventsource.Record{Version: 3},
+		Offset:      42,
+		AggregateID: "abc",
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, p.Close())
+
+	assert.Len(t, producer.messages, 1)
+	headers := map[string]string{}
+	for _, h := range producer.messages[0].Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	assert.Equal(t, map[string]string{
+		kafka.HeaderAggregateID: "abc",
+		kafka.HeaderVersion:     "3",
+		kafka.HeaderOffset:      "42",
+		kafka.HeaderEventType:   "Created",
+	}, headers)
+}
+
+func TestAsyncPublisherTraceHeaders(t *testing.T) {
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("publish")
+	span.SetBaggageItem("tenant", "t1")
+	traced := opentracing.ContextWithSpan(context.Background(), span)
+
+	// the publisher is constructed with a trace context that must not leak into other calls
+	producer := newRecordingProducer()
+	p := kafka.NewAsyncPublisher(traced, producer, "topic")
+
+	assert.Nil(t, p.PublishContext(traced, eventsource.StreamRecord{Offset: 1}))
+	assert.Nil(t, p.Publish(eventsource.StreamRecord{Offset: 2}))
+	assert.Nil(t, p.Close())
+
+	baggage := func(message *sarama.ProducerMessage) string {
+		for _, h := range message.Headers {
+			if string(h.Key) == kafka.HeaderBaggagePrefix+"tenant" {
+				return string(h.Value)
+			}
+		}
+		return ""
+	}
+	assert.Len(t, producer.messages, 2)
+	assert.Equal(t, "t1", baggage(producer.messages[0]))
+	assert.Equal(t, "", baggage(producer.messages[1]))
+}
+
+func TestAsyncPublisherCloseWhileBlocked(t *testing.T) {
+	hold := make(chan struct{})
+	producer := newHeldProducer(hold)
+	p := kafka.NewAsyncPublisher(context.Background(), producer, "topic")
+
+	blocked := make(chan error, 1)
+	go func() { blocked <- p.Publish(eventsource.StreamRecord{Offset: 1}) }()
+	time.Sleep(time.Millisecond * 50) // send blocked by the producer
+
+	closed := make(chan error, 1)
+	go func() { closed <- p.Close() }()
+	time.Sleep(time.Millisecond * 50)
+
+	// the blocked send must not prevent Close from rejecting further records
+	rejected := make(chan error, 1)
+	go func() { rejected <- p.Publish(eventsource.StreamRecord{Offset: 2}) }()
+	select {
+	case err := <-rejected:
+		assert.Equal(t, kafka.ErrPublisherClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked behind Close")
+	}
+
+	close(hold)
+	assert.Nil(t, <-blocked, "expected records accepted before Close to be delivered")
+	assert.Nil(t, <-closed)
+}
+
+func TestAsyncPublisherBatch(t *testing.T) {
+	producer := newAsyncProducer(t)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(io.ErrUnexpectedEOF)
+	producer.ExpectInputAndSucceed()
+
+	p := kafka.NewAsyncPublisher(context.Background(), producer, "topic")
+	err := p.PublishBatch([]eventsource.StreamRecord{{Offset: 1}, {Offset: 2}, {Offset: 3}})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "offset, 2")
+
+	assert.Nil(t, p.Close())
+}
+
+func TestAsyncPublisherFlushWhilePublishing(t *testing.T) {
+	producer := newRecordingProducer()
+	p := kafka.NewAsyncPublisher(context.Background(), producer, "topic")
+
+	var _ eventsourcex.ContextPublisher = p
+	var _ eventsourcex.BatchContextPublisher = p
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				assert.Nil(t, p.Publish(eventsource.StreamRecord{Offset: uint64(i*50 + j)}))
+			}
+		}(i)
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		for i := 0; i < 50; i++ {
+			p.Flush()
+		}
+	}()
+
+	wg.Wait()
+	<-flushed
+	p.Flush()
+	assert.Nil(t, p.Close())
+	assert.Len(t, producer.messages, 200)
+}
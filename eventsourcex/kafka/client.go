@@ -1,31 +1,80 @@
+// Package kafka publishes and subscribes to event streams using kafka.
+//
+// SASL authentication is limited to SASL/PLAIN.  SCRAM-SHA-256 and SCRAM-SHA-512 are not yet
+// supported as the sarama version this package builds against, v1.17, only implements PLAIN;
+// Config.Apply rejects them with ErrSCRAMUnsupported.
 package kafka
 
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Shopify/sarama"
 	cluster "github.com/bsm/sarama-cluster"
 	"github.com/pkg/errors"
 )
 
+// SASL mechanisms recognized by Config
+const (
+	// SASLPlain authenticates using SASL/PLAIN
+	SASLPlain = "PLAIN"
+
+	// SASLScramSHA256 is not yet supported; see ErrSCRAMUnsupported
+	SASLScramSHA256 = "SCRAM-SHA-256"
+
+	// SASLScramSHA512 is not yet supported; see ErrSCRAMUnsupported
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// ErrSCRAMUnsupported is returned by Config.Apply for the SCRAM mechanisms, which the sarama
+// version in use does not implement
+var ErrSCRAMUnsupported = errors.New("SASL/SCRAM is not supported by this version of sarama")
+
 // Config contains the configuration parameters for the kafka producer
 type Config struct {
-	CertPEM    []byte
-	KeyPEM     []byte
-	CaPEM      []byte
-	BrokerList []string
+	// CertPEM, KeyPEM and CaPEM contain the client certificate, its key and the certificate authority
+	// in PEM form; CertFile, KeyFile and CaFile may be used instead to load them from files
+	CertPEM  []byte
+	KeyPEM   []byte
+	CaPEM    []byte
+	CertFile string
+	KeyFile  string
+	CaFile   string
+
+	// TLS enables TLS without a client certificate; TLS is implied when any certificate is provided
+	TLS bool
+
+	// VerifyTLS verifies the broker's certificate chain and host name; ServerName overrides the host
+	// name expected
 	VerifyTLS  bool
+	ServerName string
+
+	// SASLMechanism enables SASL authentication using SASLUser and SASLPassword; only SASLPlain is
+	// supported.  Any other value, including the SCRAM mechanisms, is rejected by Apply.
+	SASLMechanism string
+	SASLUser      string
+	SASLPassword  string
+
+	// ClientID identifies the client to the brokers; defaults to sarama
+	ClientID string
+
+	// Version is the kafka version of the brokers e.g. 1.0.0; defaults to the oldest supported
+	Version string
+
+	BrokerList []string
 }
 
 func (c *Config) tlsEnabled() bool {
-	return c.CertPEM != nil && c.KeyPEM != nil && c.CaPEM != nil
+	return c.TLS || c.CertPEM != nil || c.KeyPEM != nil || c.CaPEM != nil ||
+		c.CertFile != "" || c.KeyFile != "" || c.CaFile != ""
 }
 
-// Apply applies the kafka.Config to the sarama.Config provided.
-// Currently only provides support for TLS sarama connections
+// Apply applies the kafka.Config to the sarama.Config provided
 func (c *Config) Apply(config *sarama.Config) error {
 	if c.tlsEnabled() {
 		tlsConfig, err := createTLSConfiguration(c)
@@ -36,6 +85,33 @@ func (c *Config) Apply(config *sarama.Config) error {
 		config.Net.TLS.Enable = true
 	}
 
+	switch c.SASLMechanism {
+	case "":
+	case SASLPlain:
+		if c.SASLUser == "" || c.SASLPassword == "" {
+			return errors.Errorf("SASL mechanism, %v, requires both a user and password", c.SASLMechanism)
+		}
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = c.SASLUser
+		config.Net.SASL.Password = c.SASLPassword
+	case SASLScramSHA256, SASLScramSHA512:
+		return errors.Wrapf(ErrSCRAMUnsupported, "unsupported SASL mechanism, %v", c.SASLMechanism)
+	default:
+		return errors.Errorf("unsupported SASL mechanism, %v", c.SASLMechanism)
+	}
+
+	if c.ClientID != "" {
+		config.ClientID = c.ClientID
+	}
+
+	if c.Version != "" {
+		version, err := sarama.ParseKafkaVersion(c.Version)
+		if err != nil {
+			return errors.Wrapf(err, "invalid kafka version, %v", c.Version)
+		}
+		config.Version = version
+	}
+
 	return nil
 }
 
@@ -48,6 +124,11 @@ func getBytes(name string) []byte {
 	return []byte(v)
 }
 
+func getBool(name string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(name))
+	return v
+}
+
 func getArrayOrElse(name string, defaultValue []string) []string {
 	v := os.Getenv(name)
 	if v == "" {
@@ -63,36 +144,123 @@ func getArrayOrElse(name string, defaultValue []string) []string {
 }
 
 // EnvConfig returns a new Config instance populated with values from the environment.
-// Expected keys are KAFKA_CERT, KAFKA_KEY, KAFKA_CA, KAFKA_BROKERS
+// Expected keys are KAFKA_CERT, KAFKA_KEY, KAFKA_CA, KAFKA_BROKERS along with the optional
+// KAFKA_CERT_FILE, KAFKA_KEY_FILE, KAFKA_CA_FILE, KAFKA_TLS, KAFKA_VERIFY_TLS, KAFKA_SERVER_NAME,
+// KAFKA_SASL_MECHANISM, KAFKA_SASL_USER, KAFKA_SASL_PASSWORD, KAFKA_CLIENT_ID and KAFKA_VERSION.
 // If KAFKA_BROKERS is not set, defaults to localhost:9092
 func EnvConfig() *Config {
 	return &Config{
-		CertPEM:    getBytes("KAFKA_CERT"),
-		KeyPEM:     getBytes("KAFKA_KEY"),
-		CaPEM:      getBytes("KAFKA_CA"),
-		BrokerList: getArrayOrElse("KAFKA_BROKERS", []string{"localhost:9092"}),
+		CertPEM:       getBytes("KAFKA_CERT"),
+		KeyPEM:        getBytes("KAFKA_KEY"),
+		CaPEM:         getBytes("KAFKA_CA"),
+		CertFile:      os.Getenv("KAFKA_CERT_FILE"),
+		KeyFile:       os.Getenv("KAFKA_KEY_FILE"),
+		CaFile:        os.Getenv("KAFKA_CA_FILE"),
+		TLS:           getBool("KAFKA_TLS"),
+		VerifyTLS:     getBool("KAFKA_VERIFY_TLS"),
+		ServerName:    os.Getenv("KAFKA_SERVER_NAME"),
+		SASLMechanism: os.Getenv("KAFKA_SASL_MECHANISM"),
+		SASLUser:      os.Getenv("KAFKA_SASL_USER"),
+		SASLPassword:  os.Getenv("KAFKA_SASL_PASSWORD"),
+		ClientID:      os.Getenv("KAFKA_CLIENT_ID"),
+		Version:       os.Getenv("KAFKA_VERSION"),
+		BrokerList:    getArrayOrElse("KAFKA_BROKERS", []string{"localhost:9092"}),
+	}
+}
+
+// loadPEM returns the inline PEM if provided, otherwise the contents of the file
+func loadPEM(label string, inline []byte, filename string) ([]byte, error) {
+	if inline != nil && filename != "" {
+		return nil, errors.Errorf("%v provided both inline and as file, %v", label, filename)
+	}
+	if inline != nil || filename == "" {
+		return inline, nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read %v, %v", label, filename)
 	}
+	return data, nil
 }
 
 func createTLSConfiguration(cfg *Config) (*tls.Config, error) {
-	cert, err := tls.X509KeyPair(cfg.CertPEM, cfg.KeyPEM)
+	certPEM, err := loadPEM("certificate", cfg.CertPEM, cfg.CertFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := loadPEM("key", cfg.KeyPEM, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := loadPEM("certificate authority", cfg.CaPEM, cfg.CaFile)
 	if err != nil {
 		return nil, err
 	}
 
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(cfg.CaPEM)
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: !cfg.VerifyTLS,
+	}
 
-	return &tls.Config{
-		Certificates:       []tls.Certificate{cert},
-		RootCAs:            caCertPool,
-		InsecureSkipVerify: true,
-	}, nil
+	switch {
+	case certPEM != nil && keyPEM != nil:
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case certPEM != nil:
+		return nil, errors.New("client certificate provided without a key")
+	case keyPEM != nil:
+		return nil, errors.New("client key provided without a certificate")
+	}
+
+	if caPEM != nil {
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("no certificates found in certificate authority PEM")
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	return tlsConfig, nil
 }
 
 // Option provides functional operators for Sarama
 type Option func(*sarama.Config)
 
+const (
+	// DefaultLinger is the default time an AsyncProducer waits for a batch to fill
+	DefaultLinger = time.Millisecond * 5
+
+	// DefaultBatchSize is the default maximum number of messages sent by an AsyncProducer in one request
+	DefaultBatchSize = 500
+)
+
+// WithLinger specifies how long the producer waits for more messages before sending a batch
+func WithLinger(d time.Duration) Option {
+	return func(config *sarama.Config) {
+		config.Producer.Flush.Frequency = d
+	}
+}
+
+// WithBatchSize specifies the number of messages that triggers a batch to be sent and the maximum
+// number of messages sent in one request
+func WithBatchSize(n int) Option {
+	return func(config *sarama.Config) {
+		config.Producer.Flush.Messages = n
+		config.Producer.Flush.MaxMessages = n
+	}
+}
+
+// WithBatchBytes specifies the number of bytes that triggers a batch to be sent
+func WithBatchBytes(n int) Option {
+	return func(config *sarama.Config) {
+		config.Producer.Flush.Bytes = n
+	}
+}
+
 // Producer creates a new kafka sync producer
 func Producer(cfg *Config, opts ...Option) (sarama.SyncProducer, error) {
 
@@ -125,6 +293,39 @@ func Producer(cfg *Config, opts ...Option) (sarama.SyncProducer, error) {
 	return producer, nil
 }
 
+// AsyncProducer creates a new kafka async producer suitable for NewAsyncPublisher.  Messages are
+// acknowledged by all in-sync replicas and returned on both the Successes and Errors channels.
+// Record headers require kafka 0.11 or later.
+func AsyncProducer(cfg *Config, opts ...Option) (sarama.AsyncProducer, error) {
+	config := sarama.NewConfig()
+	if err := cfg.Apply(config); err != nil {
+		return nil, err
+	}
+
+	if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		config.Version = sarama.V0_11_0_0
+	}
+	config.Net.MaxOpenRequests = 1 // retries must not reorder events for an aggregate
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 10
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Producer.Flush.Frequency = DefaultLinger
+	config.Producer.Flush.Messages = DefaultBatchSize
+	config.Producer.Flush.MaxMessages = DefaultBatchSize
+
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	producer, err := sarama.NewAsyncProducer(cfg.BrokerList, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create kafka async producer")
+	}
+
+	return producer, nil
+}
+
 // Consumer creates a new kafka sync producer
 func Consumer(cfg *Config, opts ...Option) (sarama.Consumer, error) {
 	config := sarama.NewConfig()
@@ -142,6 +343,17 @@ func Consumer(cfg *Config, opts ...Option) (sarama.Consumer, error) {
 // ClusterConsumer creates a clustered kafka consumer that uses kafka's built in offset tracking mechanism
 // to manage offsets.
 func ClusterConsumer(cfg *Config, consumerGroup string, topics []string, opts ...Option) (*cluster.Consumer, error) {
+	return newClusterConsumer(cfg, consumerGroup, topics, cluster.ConsumerModeMultiplex, opts...)
+}
+
+// ClusterPartitionConsumer creates a clustered kafka consumer that exposes each claimed partition
+// separately; suitable for SubscribeGroup.  Consumer.MaxProcessingTime bounds how long revoked
+// partitions are given to drain during a rebalance.
+func ClusterPartitionConsumer(cfg *Config, consumerGroup string, topics []string, opts ...Option) (*cluster.Consumer, error) {
+	return newClusterConsumer(cfg, consumerGroup, topics, cluster.ConsumerModePartitions, opts...)
+}
+
+func newClusterConsumer(cfg *Config, consumerGroup string, topics []string, mode cluster.ConsumerMode, opts ...Option) (*cluster.Consumer, error) {
 	config := cluster.NewConfig()
 	if err := cfg.Apply(&config.Config); err != nil {
 		return nil, err
@@ -150,11 +362,16 @@ func ClusterConsumer(cfg *Config, consumerGroup string, topics []string, opts ..
 	config.Consumer.Offsets.Initial = sarama.OffsetOldest
 	config.Consumer.Return.Errors = true
 	config.Group.Return.Notifications = true
+	config.Group.Mode = mode
 
 	for _, opt := range opts {
 		opt(&config.Config)
 	}
 
+	if mode == cluster.ConsumerModePartitions {
+		config.Group.Offsets.Synchronization.DwellTime = config.Consumer.MaxProcessingTime
+	}
+
 	consumer, err := cluster.NewConsumer(cfg.BrokerList, consumerGroup, topics, config)
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to create clustered kafka consumer for topics, %v", topics)
@@ -0,0 +1,166 @@
+package kafka_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/altairsix/pkg/eventsourcex/kafka"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// selfSigned returns a self signed certificate and key in PEM form
+func selfSigned(t *testing.T) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM
+}
+
+func TestConfigApplySCRAM(t *testing.T) {
+	for _, mechanism := range []string{kafka.SASLScramSHA256, kafka.SASLScramSHA512} {
+		c := kafka.Config{SASLMechanism: mechanism, SASLUser: "user", SASLPassword: "password"}
+		err := c.Apply(sarama.NewConfig())
+		assert.Equal(t, kafka.ErrSCRAMUnsupported, errors.Cause(err), mechanism)
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	certPEM, keyPEM := selfSigned(t)
+
+	dir, err := ioutil.TempDir("", "kafka")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+
+	testCases := map[string]struct {
+		Config  kafka.Config
+		HasErr  bool
+		Inspect func(t *testing.T, config *sarama.Config)
+	}{
+		"empty": {
+			Inspect: func(t *testing.T, config *sarama.Config) {
+				assert.False(t, config.Net.TLS.Enable)
+				assert.False(t, config.Net.SASL.Enable)
+			},
+		},
+		"inline pem": {
+			Config: kafka.Config{CertPEM: certPEM, KeyPEM: keyPEM, CaPEM: certPEM},
+			Inspect: func(t *testing.T, config *sarama.Config) {
+				assert.True(t, config.Net.TLS.Enable)
+				assert.True(t, config.Net.TLS.Config.InsecureSkipVerify)
+				assert.Len(t, config.Net.TLS.Config.Certificates, 1)
+				assert.NotNil(t, config.Net.TLS.Config.RootCAs)
+			},
+		},
+		"files with verification": {
+			Config: kafka.Config{CertFile: certFile, KeyFile: keyFile, CaFile: certFile, VerifyTLS: true, ServerName: "kafka"},
+			Inspect: func(t *testing.T, config *sarama.Config) {
+				assert.True(t, config.Net.TLS.Enable)
+				assert.False(t, config.Net.TLS.Config.InsecureSkipVerify)
+				assert.Equal(t, "kafka", config.Net.TLS.Config.ServerName)
+				assert.Len(t, config.Net.TLS.Config.Certificates, 1)
+			},
+		},
+		"tls without client cert": {
+			Config: kafka.Config{TLS: true, VerifyTLS: true},
+			Inspect: func(t *testing.T, config *sarama.Config) {
+				assert.True(t, config.Net.TLS.Enable)
+				assert.Len(t, config.Net.TLS.Config.Certificates, 0)
+				assert.Nil(t, config.Net.TLS.Config.RootCAs)
+			},
+		},
+		"cert without key": {
+			Config: kafka.Config{CertPEM: certPEM},
+			HasErr: true,
+		},
+		"key without cert": {
+			Config: kafka.Config{KeyFile: keyFile},
+			HasErr: true,
+		},
+		"inline and file": {
+			Config: kafka.Config{CertPEM: certPEM, CertFile: certFile, KeyPEM: keyPEM},
+			HasErr: true,
+		},
+		"missing file": {
+			Config: kafka.Config{CaFile: filepath.Join(dir, "missing.pem")},
+			HasErr: true,
+		},
+		"invalid ca": {
+			Config: kafka.Config{CaPEM: []byte("junk")},
+			HasErr: true,
+		},
+		"sasl plain": {
+			Config: kafka.Config{SASLMechanism: kafka.SASLPlain, SASLUser: "user", SASLPassword: "password"},
+			Inspect: func(t *testing.T, config *sarama.Config) {
+				assert.True(t, config.Net.SASL.Enable)
+				assert.Equal(t, "user", config.Net.SASL.User)
+				assert.Equal(t, "password", config.Net.SASL.Password)
+			},
+		},
+		"sasl without password": {
+			Config: kafka.Config{SASLMechanism: kafka.SASLPlain, SASLUser: "user"},
+			HasErr: true,
+		},
+		"sasl unknown": {
+			Config: kafka.Config{SASLMechanism: "GSSAPI"},
+			HasErr: true,
+		},
+		"client id and version": {
+			Config: kafka.Config{ClientID: "publisher", Version: "1.0.0"},
+			Inspect: func(t *testing.T, config *sarama.Config) {
+				assert.Equal(t, "publisher", config.ClientID)
+				assert.Equal(t, sarama.V1_0_0_0, config.Version)
+			},
+		},
+		"invalid version": {
+			Config: kafka.Config{Version: "latest"},
+			HasErr: true,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			config := sarama.NewConfig()
+			err := tc.Config.Apply(config)
+			if tc.HasErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			tc.Inspect(t, config)
+		})
+	}
+}
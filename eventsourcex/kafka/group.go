@@ -0,0 +1,188 @@
+package kafka
+
+import (
+	"context"
+	"io"
+
+	"github.com/altairsix/pkg/eventsourcex"
+	"github.com/altairsix/pkg/tracer"
+	cluster "github.com/bsm/sarama-cluster"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+)
+
+// GroupConsumer contains the subset of *cluster.Consumer used by SubscribeGroup.  The consumer must
+// be created in partition mode e.g. with ClusterPartitionConsumer.
+type GroupConsumer interface {
+	Partitions() <-chan cluster.PartitionConsumer
+	Notifications() <-chan *cluster.Notification
+	Errors() <-chan error
+	CommitOffsets() error
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// GroupOption provides functional options to SubscribeGroup
+type GroupOption func(*group)
+
+// WithClaimHandler creates a Handler for each claimed partition rather than sharing a single Handler
+// across claims.  Required for Handlers that implement eventsourcex.Acker, as acknowledged offsets
+// can only be attributed to a partition if the Handler consumes a single claim.  Handlers that
+// implement io.Closer are closed, flushing any pending acknowledgements, once their claim is
+// released.
+func WithClaimHandler(fn HandlerFactory) GroupOption {
+	return func(g *group) {
+		g.factory = fn
+	}
+}
+
+type group struct {
+	factory HandlerFactory
+}
+
+// SubscribeGroup subscribes a message handler to the partitions assigned to this member of the
+// consumer group.  Each claimed partition is consumed in its own goroutine.  Handlers that implement
+// eventsourcex.Acker, such as MessageHandler, have offsets marked as they are acknowledged; all
+// other Handlers have offsets marked once Receive returns.  Marked offsets are committed by the
+// consumer periodically, when a rebalance releases the claims, and when the subscription shuts down.
+//
+// When a rebalance starts, sarama-cluster stops every claim, waits
+// Group.Offsets.Synchronization.DwellTime, then commits the marked offsets.  Each claim drains as
+// soon as it is stopped: the message being received is finished and a Handler created by
+// WithClaimHandler is closed so that it may process and acknowledge what it has buffered.  Newly
+// claimed partitions are not started until the previous claims have drained, so a partition is never
+// handled twice at once by the same member.
+//
+// Delivery is at-least-once.  Offsets marked after the dwell time has elapsed, or not marked before
+// the member fails, are not committed, and those messages will be consumed again by the next owner
+// of the partition; Handlers must tolerate reprocessing.
+func SubscribeGroup(ctx context.Context, consumer GroupConsumer, h eventsourcex.Handler, opts ...GroupOption) (*Subscription, error) {
+	g := &group{}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	if _, ok := h.(eventsourcex.Acker); ok && g.factory == nil {
+		return nil, errors.New("handler acknowledges offsets and cannot be shared across claims; use WithClaimHandler")
+	}
+
+	child, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer cancel()
+
+		segment, child := tracer.NewSegment(child, "kafka:consume_group")
+		defer segment.Finish()
+
+		workers := map[topicPartition]chan struct{}{}
+		drain := func() {
+			for tp, stopped := range workers {
+				<-stopped
+				delete(workers, tp)
+			}
+		}
+
+		defer func() {
+			drain()
+			if err := consumer.CommitOffsets(); err != nil {
+				segment.LogFields(log.Error(err), log.String("text", "unable to commit offsets"))
+			}
+		}()
+
+		for {
+			select {
+			case <-child.Done():
+				return
+
+			case pc, ok := <-consumer.Partitions():
+				if !ok {
+					return // consumer closed
+				}
+
+				tp := topicPartition{topic: pc.Topic(), partition: pc.Partition()}
+				if stopped, ok := workers[tp]; ok {
+					<-stopped // previous claim on this partition must finish first
+				}
+
+				stopped := make(chan struct{})
+				workers[tp] = stopped
+				go func() {
+					defer close(stopped)
+					consumeClaim(child, pc, h, g.factory)
+				}()
+
+			case n, ok := <-consumer.Notifications():
+				if !ok {
+					return
+				}
+				segment.Info("kafka:rebalance", log.String("type", n.Type.String()), log.Int("released", len(n.Released)), log.Int("claimed", len(n.Claimed)))
+
+				if n.Type == cluster.RebalanceStart {
+					drain() // every claim has been stopped by the time the rebalance starts
+				}
+
+			case err, ok := <-consumer.Errors():
+				if !ok {
+					return
+				}
+				segment.LogFields(log.Error(err))
+			}
+		}
+	}()
+
+	return &Subscription{
+		cancel: cancel,
+		done:   done,
+	}, nil
+}
+
+// consumeClaim feeds the partition to the handler until the partition is revoked or the context
+// canceled.  Offsets are marked as the handler processes them and the handler, if created by the
+// factory, is closed before returning so the claim is drained before its offsets are committed.
+func consumeClaim(ctx context.Context, pc cluster.PartitionConsumer, h eventsourcex.Handler, factory HandlerFactory) {
+	segment, ctx := tracer.NewSegment(ctx, "kafka:consume_claim", log.String("topic", pc.Topic()), log.Int32("partition", pc.Partition()))
+	defer segment.Finish()
+
+	handler := h
+	if factory != nil {
+		var err error
+		if handler, err = factory(pc.Topic(), pc.Partition()); err != nil {
+			segment.LogFields(log.Error(err), log.String("text", "unable to create claim handler"))
+			return
+		}
+		if closer, ok := handler.(io.Closer); ok {
+			defer closer.Close()
+		}
+	}
+
+	acker, async := handler.(eventsourcex.Acker)
+	if async {
+		acker.OnAck(func(offset uint64) {
+			pc.MarkOffset(int64(offset), "")
+		})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-pc.Messages():
+			if !ok {
+				return // partition revoked
+			}
+			handler.Receive(uint64(message.Offset), message.Value)
+
+			if !async {
+				pc.MarkOffset(message.Offset, "")
+			}
+		}
+	}
+}
+
+// assert *cluster.Consumer implements GroupConsumer
+var _ GroupConsumer = (*cluster.Consumer)(nil)
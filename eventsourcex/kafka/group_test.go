@@ -0,0 +1,182 @@
+package kafka_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/altairsix/pkg/eventsourcex"
+	"github.com/altairsix/pkg/eventsourcex/kafka"
+	cluster "github.com/bsm/sarama-cluster"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockClaim struct {
+	cluster.PartitionConsumer
+
+	partition int32
+	messages  chan *sarama.ConsumerMessage
+
+	mutex  sync.Mutex
+	marked int64
+}
+
+func (m *MockClaim) Topic() string                            { return "topic" }
+func (m *MockClaim) Partition() int32                         { return m.partition }
+func (m *MockClaim) Messages() <-chan *sarama.ConsumerMessage { return m.messages }
+func (m *MockClaim) MarkOffset(offset int64, metadata string) {
+	m.mutex.Lock()
+	m.marked = offset
+	m.mutex.Unlock()
+}
+func (m *MockClaim) Marked() int64 { m.mutex.Lock(); defer m.mutex.Unlock(); return m.marked }
+
+func NewClaim(partition int32) *MockClaim {
+	return &MockClaim{
+		partition: partition,
+		messages:  make(chan *sarama.ConsumerMessage),
+		marked:    -1,
+	}
+}
+
+type MockGroup struct {
+	partitions    chan cluster.PartitionConsumer
+	notifications chan *cluster.Notification
+	errors        chan error
+
+	mutex   sync.Mutex
+	commits int
+}
+
+func (m *MockGroup) Partitions() <-chan cluster.PartitionConsumer { return m.partitions }
+func (m *MockGroup) Notifications() <-chan *cluster.Notification  { return m.notifications }
+func (m *MockGroup) Errors() <-chan error                         { return m.errors }
+func (m *MockGroup) CommitOffsets() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.commits++
+	return nil
+}
+
+func NewGroup() *MockGroup {
+	return &MockGroup{
+		partitions:    make(chan cluster.PartitionConsumer),
+		notifications: make(chan *cluster.Notification),
+		errors:        make(chan error),
+	}
+}
+
+func TestSubscribeGroup(t *testing.T) {
+	group := NewGroup()
+
+	var mutex sync.Mutex
+	received := map[uint64]int{}
+	release := make(chan struct{})
+	h := eventsourcex.HandlerFunc(func(offset uint64, data []byte) {
+		if string(data) == "slow" {
+			<-release
+		}
+		mutex.Lock()
+		received[offset]++
+		mutex.Unlock()
+	})
+
+	sub, err := kafka.SubscribeGroup(context.Background(), group, h)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	claim := NewClaim(0)
+	group.partitions <- claim
+	claim.messages <- &sarama.ConsumerMessage{Offset: 1, Value: []byte("a")}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 2, Value: []byte("slow")}
+
+	// rebalance starts while offset 2 is still being handled; the claim is revoked
+	close(claim.messages)
+	group.notifications <- &cluster.Notification{Type: cluster.RebalanceStart}
+
+	// the new claim must not be accepted until the revoked claim has drained
+	reclaim := NewClaim(0)
+	accepted := make(chan struct{})
+	go func() {
+		group.partitions <- reclaim
+		close(accepted)
+	}()
+
+	select {
+	case <-accepted:
+		t.Fatal("new claim accepted before the revoked claim drained")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(release)
+	<-accepted
+	assert.Equal(t, int64(2), claim.Marked())
+
+	reclaim.messages <- &sarama.ConsumerMessage{Offset: 3, Value: []byte("b")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, sub.Shutdown(ctx))
+
+	assert.Equal(t, map[uint64]int{1: 1, 2: 1, 3: 1}, received)
+	assert.Equal(t, int64(3), reclaim.Marked())
+	assert.Equal(t, 1, group.commits)
+}
+
+// bufferedAcker acknowledges everything it has received when closed, like a MessageHandler
+// flushing its buffer
+type bufferedAcker struct {
+	*MockAcker
+}
+
+func (b bufferedAcker) Close() error {
+	b.mutex.Lock()
+	last := b.received[len(b.received)-1]
+	b.mutex.Unlock()
+
+	b.Ack(last)
+	return b.MockAcker.Close()
+}
+
+func TestSubscribeGroupAcker(t *testing.T) {
+	group := NewGroup()
+
+	h := bufferedAcker{MockAcker: &MockAcker{}}
+	factory := func(topic string, partition int32) (eventsourcex.Handler, error) {
+		return h, nil
+	}
+
+	sub, err := kafka.SubscribeGroup(context.Background(), group, nil, kafka.WithClaimHandler(factory))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	claim := NewClaim(0)
+	group.partitions <- claim
+	claim.messages <- &sarama.ConsumerMessage{Offset: 1, Value: []byte("a")}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 2, Value: []byte("b")}
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, int64(-1), claim.Marked(), "expected nothing marked until the handler acks")
+
+	h.Ack(1)
+	assert.Equal(t, int64(1), claim.Marked())
+
+	// revoking the claim closes the handler, which acks what it has buffered
+	close(claim.messages)
+	group.notifications <- &cluster.Notification{Type: cluster.RebalanceStart}
+	group.notifications <- &cluster.Notification{Type: cluster.RebalanceOK} // accepted once drained
+	assert.Equal(t, int64(2), claim.Marked())
+	assert.True(t, h.closed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, sub.Shutdown(ctx))
+
+	t.Run("shared acker", func(t *testing.T) {
+		_, err := kafka.SubscribeGroup(context.Background(), NewGroup(), &MockAcker{})
+		assert.NotNil(t, err)
+	})
+}
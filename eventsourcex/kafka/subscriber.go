@@ -2,8 +2,11 @@ package kafka
 
 import (
 	"context"
+	"io"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/altairsix/pkg/eventsourcex"
@@ -35,8 +38,151 @@ func (s *Subscription) Shutdown(ctx context.Context) error {
 	}
 }
 
+// StartFrom identifies where a partition is consumed from
+type StartFrom int
+
+const (
+	// StartNewest consumes only messages published after the subscription starts
+	StartNewest StartFrom = iota
+
+	// StartOldest consumes from the oldest available message
+	StartOldest
+
+	// StartCheckpoint consumes from the message after the offset saved in the Checkpointer;
+	// partitions without a checkpoint are consumed from the oldest available message.  As 0 means
+	// no checkpoint, a partition checkpointed at offset 0 consumes that message again.
+	StartCheckpoint
+
+	// StartTimestamp consumes from the first message published at or after a point in time
+	StartTimestamp
+)
+
+// OffsetGetter looks up offsets by time; implemented by sarama.Client
+type OffsetGetter interface {
+	GetOffset(topic string, partition int32, time int64) (int64, error)
+}
+
+// SubscribeOption provides functional options to SubscribeStream
+type SubscribeOption func(*subscribe)
+
+// WithCheckpointer commits offsets to the Checkpointer once the Handler has processed each message.
+// Offsets are saved using the key returned by CheckpointKey and, like MessageHandler, record the
+// offset of the last message processed.  Implies StartCheckpoint unless another start is specified.
+//
+// Handlers that implement eventsourcex.Acker, such as MessageHandler, have offsets committed as they
+// are acknowledged; all other Handlers have offsets committed once Receive returns.
+func WithCheckpointer(cp eventsourcex.Checkpointer) SubscribeOption {
+	return func(s *subscribe) {
+		s.cp = cp
+		if !s.startSet {
+			s.start = StartCheckpoint
+		}
+	}
+}
+
+// HandlerFactory returns the Handler for a topic partition
+type HandlerFactory func(topic string, partition int32) (eventsourcex.Handler, error)
+
+// WithPartitionHandler creates a Handler for each partition rather than sharing a single Handler
+// across partitions.  Required for Handlers that implement eventsourcex.Acker, as acknowledged
+// offsets can only be attributed to a partition if the Handler consumes a single partition.
+// Handlers that implement io.Closer are closed, flushing any pending acknowledgements, once their
+// partition stops.
+func WithPartitionHandler(fn HandlerFactory) SubscribeOption {
+	return func(s *subscribe) {
+		s.factory = fn
+	}
+}
+
+// WithStartFrom specifies where partitions are consumed from; defaults to StartNewest or, if a
+// Checkpointer is provided, StartCheckpoint
+func WithStartFrom(start StartFrom) SubscribeOption {
+	return func(s *subscribe) {
+		s.start = start
+		s.startSet = true
+	}
+}
+
+// WithStartAt consumes partitions from the first message published at or after t; client, usually a
+// sarama.Client, is used to look up the offsets
+func WithStartAt(t time.Time, client OffsetGetter) SubscribeOption {
+	return func(s *subscribe) {
+		s.start = StartTimestamp
+		s.startSet = true
+		s.startAt = t
+		s.offsets = client
+	}
+}
+
+// WithCommitInterval limits how often offsets are committed to the Checkpointer; defaults to 0,
+// commit after every message.  Offsets are always committed when the subscription shuts down.
+func WithCommitInterval(d time.Duration) SubscribeOption {
+	return func(s *subscribe) {
+		s.commitInterval = d
+	}
+}
+
+type subscribe struct {
+	cp             eventsourcex.Checkpointer
+	start          StartFrom
+	startSet       bool
+	startAt        time.Time
+	offsets        OffsetGetter
+	commitInterval time.Duration
+	factory        HandlerFactory
+}
+
+// CheckpointKey returns the Checkpointer key used for the topic partition
+func CheckpointKey(topic string, partition int32) string {
+	return "kafka:" + topic + ":" + strconv.Itoa(int(partition))
+}
+
+// initialOffset returns the offset the partition should be consumed from
+func (s *subscribe) initialOffset(ctx context.Context, topic string, partition int32) (int64, error) {
+	switch s.start {
+	case StartOldest:
+		return sarama.OffsetOldest, nil
+
+	case StartCheckpoint:
+		key := CheckpointKey(topic, partition)
+		v, err := s.cp.Load(ctx, key)
+		if err != nil {
+			return 0, errors.Wrapf(err, "unable to load checkpoint, %v", key)
+		}
+		if v == 0 {
+			return sarama.OffsetOldest, nil
+		}
+		return int64(v) + 1, nil // checkpoint records the last message processed
+
+	case StartTimestamp:
+		millis := s.startAt.UnixNano() / int64(time.Millisecond)
+		offset, err := s.offsets.GetOffset(topic, partition, millis)
+		if err != nil {
+			return 0, errors.Wrapf(err, "unable to find offset for topic, %v, partition, %v, at %v", topic, partition, s.startAt)
+		}
+		return offset, nil
+
+	default:
+		return sarama.OffsetNewest, nil
+	}
+}
+
 // SubscribeStream subscribes a message handler to the specified Kafka topic
-func SubscribeStream(ctx context.Context, consumer sarama.Consumer, topic string, h eventsourcex.Handler) (*Subscription, error) {
+func SubscribeStream(ctx context.Context, consumer sarama.Consumer, topic string, h eventsourcex.Handler, opts ...SubscribeOption) (*Subscription, error) {
+	s := &subscribe{
+		start: StartNewest,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.start == StartCheckpoint && s.cp == nil {
+		return nil, errors.New("StartCheckpoint requires a Checkpointer; use WithCheckpointer")
+	}
+	if s.start == StartTimestamp && s.offsets == nil {
+		return nil, errors.New("StartTimestamp requires an OffsetGetter; use WithStartAt")
+	}
+
 	child, cancel := context.WithCancel(ctx)
 
 	partitions, err := consumer.Partitions(topic)
@@ -45,6 +191,11 @@ func SubscribeStream(ctx context.Context, consumer sarama.Consumer, topic string
 		return nil, errors.Wrapf(err, "unable to find partitions for topic, %v", topic)
 	}
 
+	if _, ok := h.(eventsourcex.Acker); ok && s.factory == nil && len(partitions) > 1 {
+		cancel()
+		return nil, errors.Errorf("handler acknowledges offsets and cannot be shared by the %v partitions of topic, %v; use WithPartitionHandler", len(partitions), topic)
+	}
+
 	wg := &sync.WaitGroup{}
 	wg.Add(len(partitions))
 	for _, partition := range partitions {
@@ -55,7 +206,62 @@ func SubscribeStream(ctx context.Context, consumer sarama.Consumer, topic string
 			segment, child := tracer.NewSegment(child, "kafka:consume_partition", log.Int32("partition", partition))
 			defer segment.Finish()
 
-			c, err := consumer.ConsumePartition(topic, partition, sarama.OffsetNewest)
+			offset, err := s.initialOffset(child, topic, partition)
+			if err != nil {
+				segment.LogFields(log.Error(err), log.String("text", "unable to determine initial offset"))
+				return
+			}
+
+			key := CheckpointKey(topic, partition)
+			var mutex sync.Mutex
+			processed, committed := int64(-1), int64(-1)
+			committedAt := time.Now()
+			commit := func(ctx context.Context, force bool) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				if s.cp == nil || processed <= committed {
+					return
+				}
+				if !force && time.Since(committedAt) < s.commitInterval {
+					return
+				}
+				if err := s.cp.Save(ctx, key, uint64(processed)); err != nil {
+					segment.LogFields(log.Error(err), log.String("text", "unable to commit offset"))
+					return
+				}
+				committed, committedAt = processed, time.Now()
+			}
+			markProcessed := func(offset int64) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				if offset > processed {
+					processed = offset
+				}
+			}
+			defer commit(context.Background(), true) // commit even though the subscription has been canceled
+
+			handler := h
+			if s.factory != nil {
+				if handler, err = s.factory(topic, partition); err != nil {
+					segment.LogFields(log.Error(err), log.String("text", "unable to create partition handler"))
+					return
+				}
+				if closer, ok := handler.(io.Closer); ok {
+					defer closer.Close() // flushes pending acks before the final commit
+				}
+			}
+
+			acker, async := handler.(eventsourcex.Acker)
+			if async {
+				acker.OnAck(func(offset uint64) {
+					markProcessed(int64(offset))
+					commit(context.Background(), false) // acks may arrive after the subscription is canceled
+				})
+			}
+
+			c, err := consumer.ConsumePartition(topic, partition, offset)
 			if err != nil {
 				segment.LogFields(log.Error(err), log.String("text", "unable to consume topic partition"))
 				return
@@ -70,7 +276,12 @@ func SubscribeStream(ctx context.Context, consumer sarama.Consumer, topic string
 					if !ok {
 						return // channel closed
 					}
-					h.Receive(uint64(message.Offset), message.Value)
+					handler.Receive(uint64(message.Offset), message.Value)
+
+					if !async {
+						markProcessed(message.Offset)
+						commit(child, false)
+					}
 				}
 			}
 		}(partition)
@@ -3,6 +3,7 @@ package kafka_test
 import (
 	"context"
 	"io"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,6 +19,7 @@ type MockConsumer struct {
 	sarama.PartitionConsumer
 
 	err      error
+	offset   int64
 	messages <-chan *sarama.ConsumerMessage
 }
 
@@ -30,6 +32,7 @@ func (m *MockConsumer) Close() error {
 }
 
 func (m *MockConsumer) ConsumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
+	m.offset = offset
 	return m, m.err
 }
 
@@ -87,6 +90,178 @@ func TestSubscriber(t *testing.T) {
 	assert.Equal(t, 1, receivedCount)
 }
 
+func TestSubscriberCheckpoint(t *testing.T) {
+	topic := randx.AlphaN(12)
+	key := kafka.CheckpointKey(topic, 0)
+	assert.Equal(t, "kafka:"+topic+":0", key)
+
+	cp := eventsourcex.MemoryCP{key: 4}
+	consumer := NewConsumer(
+		&sarama.ConsumerMessage{Offset: 5, Value: []byte("a")},
+		&sarama.ConsumerMessage{Offset: 6, Value: []byte("b")},
+	)
+
+	var offsets []uint64
+	fn := eventsourcex.HandlerFunc(func(offset uint64, data []byte) {
+		offsets = append(offsets, offset)
+	})
+
+	ctx := context.Background()
+	sub, err := kafka.SubscribeStream(ctx, consumer, topic, fn, kafka.WithCheckpointer(cp))
+	if !assert.Nil(t, err) {
+		return
+	}
+	<-sub.Done()
+
+	assert.Equal(t, int64(5), consumer.offset)
+	assert.Equal(t, []uint64{5, 6}, offsets)
+	assert.Equal(t, uint64(6), cp[key], "expected last processed offset to be committed")
+
+	t.Run("no checkpoint", func(t *testing.T) {
+		consumer := NewConsumer()
+		sub, err := kafka.SubscribeStream(ctx, consumer, topic, fn, kafka.WithCheckpointer(eventsourcex.MemoryCP{}))
+		assert.Nil(t, err)
+		<-sub.Done()
+		assert.Equal(t, sarama.OffsetOldest, consumer.offset)
+	})
+
+	t.Run("requires checkpointer", func(t *testing.T) {
+		_, err := kafka.SubscribeStream(ctx, NewConsumer(), topic, fn, kafka.WithStartFrom(kafka.StartCheckpoint))
+		assert.NotNil(t, err)
+	})
+}
+
+type MockAcker struct {
+	mutex    sync.Mutex
+	received []uint64
+	acks     []func(offset uint64)
+	closed   bool
+}
+
+func (m *MockAcker) Receive(offset uint64, data []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.received = append(m.received, offset)
+}
+
+func (m *MockAcker) OnAck(fn func(offset uint64)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.acks = append(m.acks, fn)
+}
+
+func (m *MockAcker) Ack(offset uint64) {
+	m.mutex.Lock()
+	acks := m.acks
+	m.mutex.Unlock()
+
+	for _, fn := range acks {
+		fn(offset)
+	}
+}
+
+func (m *MockAcker) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closed = true
+	return nil
+}
+
+func TestSubscriberAcker(t *testing.T) {
+	topic := randx.AlphaN(12)
+	key := kafka.CheckpointKey(topic, 0)
+
+	messages := make(chan *sarama.ConsumerMessage, 2)
+	messages <- &sarama.ConsumerMessage{Offset: 1, Value: []byte("a")}
+	messages <- &sarama.ConsumerMessage{Offset: 2, Value: []byte("b")}
+	consumer := &MockConsumer{messages: messages}
+
+	cp := &lockedCP{cp: eventsourcex.MemoryCP{}}
+	h := &MockAcker{}
+	factory := func(topic string, partition int32) (eventsourcex.Handler, error) {
+		return h, nil
+	}
+
+	ctx := context.Background()
+	sub, err := kafka.SubscribeStream(ctx, consumer, topic, nil, kafka.WithCheckpointer(cp), kafka.WithPartitionHandler(factory))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, uint64(0), cp.Get(key), "expected nothing committed until the handler acks")
+
+	h.Ack(1)
+	assert.Equal(t, uint64(1), cp.Get(key))
+
+	close(messages)
+	<-sub.Done()
+	assert.True(t, h.closed)
+
+	h.Ack(2) // acks that arrive after the subscription stops are still committed
+	assert.Equal(t, uint64(2), cp.Get(key))
+
+	t.Run("shared acker requires a single partition", func(t *testing.T) {
+		consumer := &MockPartitions{MockConsumer: NewConsumer(), partitions: []int32{0, 1}}
+		_, err := kafka.SubscribeStream(ctx, consumer, topic, &MockAcker{})
+		assert.NotNil(t, err)
+	})
+}
+
+type MockPartitions struct {
+	*MockConsumer
+	partitions []int32
+}
+
+func (m *MockPartitions) Partitions(topic string) ([]int32, error) {
+	return m.partitions, nil
+}
+
+type lockedCP struct {
+	mutex sync.Mutex
+	cp    eventsourcex.MemoryCP
+}
+
+func (l *lockedCP) Load(ctx context.Context, key string) (uint64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.cp.Load(ctx, key)
+}
+
+func (l *lockedCP) Save(ctx context.Context, key string, offset uint64) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.cp.Save(ctx, key, offset)
+}
+
+func (l *lockedCP) Get(key string) uint64 {
+	v, _ := l.Load(context.Background(), key)
+	return v
+}
+
+type MockOffsets struct {
+	time int64
+}
+
+func (m *MockOffsets) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	m.time = time
+	return 42, nil
+}
+
+func TestSubscriberStartAt(t *testing.T) {
+	startAt := time.Now().Add(-time.Hour)
+	offsets := &MockOffsets{}
+	consumer := NewConsumer()
+
+	fn := eventsourcex.HandlerFunc(func(offset uint64, data []byte) {})
+	sub, err := kafka.SubscribeStream(context.Background(), consumer, "topic", fn, kafka.WithStartAt(startAt, offsets))
+	assert.Nil(t, err)
+	<-sub.Done()
+
+	assert.Equal(t, startAt.UnixNano()/int64(time.Millisecond), offsets.time)
+	assert.Equal(t, int64(42), consumer.offset)
+}
+
 func TestMakeTopicName(t *testing.T) {
 	topic := kafka.MakeTopicName("a", "b", "c", "d")
 	assert.Equal(t, "a.b.c.d", topic)
@@ -2,19 +2,21 @@ package eventsourcex
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/altairsix/eventsource"
 	"github.com/altairsix/pkg/action"
 	"github.com/altairsix/pkg/action/heartbeat"
-	"github.com/altairsix/pkg/checkpoint"
 	"github.com/altairsix/pkg/tracer"
 	"github.com/nats-io/go-nats"
 	"github.com/nats-io/go-nats-streaming"
 	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -23,6 +25,12 @@ const (
 
 	// DefaultPublishInterval the amount of time between checking the repository for updates
 	DefaultPublishInterval = time.Minute
+
+	// DefaultCheckDebounce the quiet period used to coalesce bursts of Check requests
+	DefaultCheckDebounce = time.Millisecond * 50
+
+	// DefaultPageSize the number of records read from the StreamReader at a time
+	DefaultPageSize = 100
 )
 
 // Publisher publishes the record to a event bus
@@ -30,6 +38,24 @@ type Publisher interface {
 	Publish(record eventsource.StreamRecord) error
 }
 
+// BatchPublisher may be implemented by Publishers that publish many records more efficiently
+// together than one at a time; PublishBatch returns once every record has been published
+type BatchPublisher interface {
+	PublishBatch(records []eventsource.StreamRecord) error
+}
+
+// ContextPublisher may be implemented by Publishers that carry the trace context of ctx with each
+// record; the supervisor prefers it to Publish
+type ContextPublisher interface {
+	PublishContext(ctx context.Context, record eventsource.StreamRecord) error
+}
+
+// BatchContextPublisher may be implemented by BatchPublishers that carry the trace context of ctx
+// with each record; the supervisor prefers it to PublishBatch
+type BatchContextPublisher interface {
+	PublishBatchContext(ctx context.Context, records []eventsource.StreamRecord) error
+}
+
 // PublisherFunc provides a func wrapper to Publisher
 type PublisherFunc func(record eventsource.StreamRecord) error
 
@@ -58,18 +84,22 @@ type supervisor struct {
 	ctx             context.Context
 	cancel          func()
 	done            chan struct{}
-	check           chan struct{}
+	checks          *action.Debouncer
 	segment         tracer.Segment
 	r               eventsource.StreamReader
 	h               Publisher
 	cpKey           string
 	cp              Checkpointer
 	interval        time.Duration
+	commitInterval  time.Duration
 	offset          uint64
 	offsetLoaded    bool
 	committedOffset uint64
 	committedAt     time.Time
 	recordCount     int
+
+	mutex sync.Mutex
+	stats Stats
 }
 
 // Close stops the worker process
@@ -81,10 +111,7 @@ func (s *supervisor) Close() error {
 
 // Check request a check from the supervisor
 func (s *supervisor) Check() {
-	select {
-	case s.check <- struct{}{}:
-	default:
-	}
+	s.checks.Trigger()
 }
 
 // Done allows external tools to signal off of when the supervisor is done
@@ -92,6 +119,36 @@ func (s *supervisor) Done() <-chan struct{} {
 	return s.done
 }
 
+// Stats returns the progress of the supervisor
+func (s *supervisor) Stats() Stats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := s.stats
+	if stats.HeadOffset > stats.Offset {
+		stats.Lag = stats.HeadOffset - stats.Offset
+	}
+	return stats
+}
+
+// updateStats records the outcome of reading a page of the stream or its head
+func (s *supervisor) updateStats(published int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stats.Offset = s.offset
+	s.stats.CommittedOffset = s.committedOffset
+	s.stats.CommittedAt = s.committedAt
+	s.stats.Published += uint64(published)
+
+	if now := time.Now(); err != nil {
+		s.stats.LastError = err.Error()
+		s.stats.LastErrorAt = now
+	} else {
+		s.stats.CheckedAt = now
+	}
+}
+
 func (s *supervisor) checkOnce() {
 	segment, ctx := tracer.NewSegment(s.ctx, "supervisor:check_once", log.String("checkpoint-key", s.cpKey))
 	defer segment.Finish()
@@ -100,6 +157,7 @@ func (s *supervisor) checkOnce() {
 		v, err := s.cp.Load(ctx, s.cpKey)
 		if err != nil {
 			segment.LogFields(log.Error(err), log.String("text", "unable to load checkpoint key"))
+			s.updateStats(0, errors.Wrap(err, "unable to load checkpoint key"))
 			return
 		}
 		s.offset = v
@@ -108,35 +166,93 @@ func (s *supervisor) checkOnce() {
 		segment.Info("supervisor:checkpoint_loaded", log.Uint64("offset", s.offset))
 	}
 
+	// keep reading while full pages come back so a backlog is drained without waiting for the next check
+	published := 0
+	for ctx.Err() == nil {
+		n, err := s.publishPage(ctx)
+		published += n
+		s.updateStats(n, err)
+		if err != nil {
+			segment.LogFields(log.Error(err))
+			break
+		}
+		if n < s.recordCount {
+			break
+		}
+		segment.Info("supervisor:catching_up", log.Uint64("offset", s.offset))
+	}
+
+	if published > 0 {
+		fmt.Fprintf(s.w, "published %v records through offset %v\n", published, s.offset)
+	}
+
+	if hr, ok := s.r.(HeadReader); ok {
+		head, err := hr.HeadOffset(ctx)
+		if err != nil {
+			segment.LogFields(log.Error(err), log.String("text", "unable to read head offset"))
+			s.updateStats(0, errors.Wrap(err, "unable to read head offset"))
+			return
+		}
+
+		s.mutex.Lock()
+		s.stats.HeadOffset = head
+		s.mutex.Unlock()
+	}
+}
+
+// publishPage publishes the next page of events and commits the offset if the commit interval has
+// elapsed; returns the number of events published
+func (s *supervisor) publishPage(ctx context.Context) (int, error) {
 	// read  events
 	events, err := s.r.Read(ctx, s.offset+1, s.recordCount)
 	if err != nil {
-		segment.LogFields(log.Error(err), log.String("text", "unable to read events from StreamReder"))
-		return
+		return 0, errors.Wrap(err, "unable to read events from StreamReader")
 	}
 
 	// publish  events
-	for _, event := range events {
-		if err := s.h.Publish(event); err != nil {
-			segment.LogFields(log.Error(err), log.String("text", "unable to publish events"))
-			return
+	if bp, ok := s.h.(BatchContextPublisher); ok {
+		if len(events) > 0 {
+			if err := bp.PublishBatchContext(ctx, events); err != nil {
+				return 0, errors.Wrap(err, "unable to publish events")
+			}
+			s.offset = events[len(events)-1].Offset
+		}
+	} else if bp, ok := s.h.(BatchPublisher); ok {
+		if len(events) > 0 {
+			if err := bp.PublishBatch(events); err != nil {
+				return 0, errors.Wrap(err, "unable to publish events")
+			}
+			s.offset = events[len(events)-1].Offset
+		}
+	} else {
+		publish := s.h.Publish
+		if cp, ok := s.h.(ContextPublisher); ok {
+			publish = func(record eventsource.StreamRecord) error { return cp.PublishContext(ctx, record) }
 		}
 
-		s.offset = event.Offset
+		for i, event := range events {
+			if err := publish(event); err != nil {
+				return i, errors.Wrap(err, "unable to publish events")
+			}
+
+			s.offset = event.Offset
+		}
 	}
 
 	// time to commit?
-	if now := time.Now(); now.Sub(s.committedAt) > DefaultCommitInterval {
-		if err := s.cp.Save(ctx, s.cpKey, s.offset); err == nil {
-			s.committedAt = now
-			s.committedOffset = s.offset
+	if now := time.Now(); s.offset != s.committedOffset && now.Sub(s.committedAt) >= s.commitInterval {
+		if err := s.cp.Save(ctx, s.cpKey, s.offset); err != nil {
+			return len(events), errors.Wrap(err, "unable to save checkpoint")
 		}
+		s.committedAt = now
+		s.committedOffset = s.offset
 	}
+
+	return len(events), nil
 }
 
 func (s *supervisor) listenAndPublish() {
 	defer close(s.done)
-	defer close(s.check)
 	defer s.segment.Finish()
 
 	s.segment.Info("supervisor:started", log.String("interval", s.interval.String()))
@@ -144,53 +260,112 @@ func (s *supervisor) listenAndPublish() {
 	timer := time.NewTicker(s.interval)
 	defer timer.Stop()
 
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-timer.C:
-			s.checkOnce()
-		case <-s.check:
-			s.checkOnce()
+	go func() {
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-timer.C:
+				s.checks.Trigger()
+			}
 		}
-	}
+	}()
+
+	// bursts of checks, one per aggregate write, are coalesced into a leading and a trailing check
+	s.checks.Run(s.ctx)
 }
 
 // WithPublishEvents publishes received events to nats
 func WithPublishEvents(fn Publisher, nc *nats.Conn, env, boundedContext string) PublisherFunc {
-	rootSubject := StreamSubject(env, boundedContext) + "."
+	return WithNotify(fn, NatsNotifier(nc, env, boundedContext))
+}
 
-	return func(event eventsource.StreamRecord) error {
-		if err := fn.Publish(event); err != nil {
-			return err
+type publishOptions struct {
+	interval       time.Duration
+	pageSize       int
+	commitInterval time.Duration
+	w              io.Writer
+	notifier       Notifier
+	notices        Notices
+	singleton      []action.SingletonOption
+	onSupervisor   func(Supervisor)
+}
+
+// PublishOption provides functional options to the stream publishers
+type PublishOption func(*publishOptions)
+
+func newPublishOptions(opts ...PublishOption) *publishOptions {
+	o := &publishOptions{
+		interval:       DefaultPublishInterval,
+		pageSize:       DefaultPageSize,
+		commitInterval: DefaultCommitInterval,
+		w:              ioutil.Discard,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithPublishInterval specifies how often the stream is checked in the absence of notices; defaults
+// to DefaultPublishInterval
+func WithPublishInterval(d time.Duration) PublishOption {
+	return func(o *publishOptions) {
+		o.interval = d
+	}
+}
+
+// WithPageSize specifies the number of records read from the StreamReader at a time; defaults to
+// DefaultPageSize
+func WithPageSize(n int) PublishOption {
+	return func(o *publishOptions) {
+		if n > 0 {
+			o.pageSize = n
 		}
+	}
+}
 
-		subject := rootSubject + event.AggregateID
-		go nc.Publish(subject, []byte(event.AggregateID))
-		return nil
+// WithCommitInterval specifies the minimum amount of time between offset commits; defaults to
+// DefaultCommitInterval
+func WithCommitInterval(d time.Duration) PublishOption {
+	return func(o *publishOptions) {
+		o.commitInterval = d
+	}
+}
+
+// WithOutput writes a line of progress each time records are published; defaults to ioutil.Discard
+func WithOutput(w io.Writer) PublishOption {
+	return func(o *publishOptions) {
+		o.w = w
 	}
 }
 
 // PublishStream reads from a stream and publishes
-func PublishStream(ctx context.Context, h Publisher, r eventsource.StreamReader, cp Checkpointer, env, bc string) Supervisor {
+func PublishStream(ctx context.Context, h Publisher, r eventsource.StreamReader, cp Checkpointer, env, bc string, opts ...PublishOption) Supervisor {
+	cfg := newPublishOptions(opts...)
+
 	cpKey := makeCheckpointKey(env, bc)
 	segment, _ := tracer.NewSegment(ctx, "publish_stream", log.String("checkpoint", cpKey))
 
 	child, cancel := context.WithCancel(ctx)
 	s := &supervisor{
-		w:           ioutil.Discard,
-		ctx:         child,
-		cancel:      cancel,
-		done:        make(chan struct{}),
-		check:       make(chan struct{}, 1),
-		segment:     segment,
-		r:           r,
-		h:           h,
-		cpKey:       cpKey,
-		cp:          cp,
-		interval:    DefaultPublishInterval,
-		recordCount: 100,
+		w:              cfg.w,
+		ctx:            child,
+		cancel:         cancel,
+		done:           make(chan struct{}),
+		segment:        segment,
+		r:              r,
+		h:              h,
+		cpKey:          cpKey,
+		cp:             cp,
+		interval:       cfg.interval,
+		commitInterval: cfg.commitInterval,
+		recordCount:    cfg.pageSize,
 	}
+	s.checks = action.NewDebouncer(DefaultCheckDebounce, func(ctx context.Context) error {
+		s.checkOnce()
+		return nil
+	}, action.WithEdge(action.EdgeLeading|action.EdgeTrailing), action.WithMaxWait(s.interval))
 
 	go s.listenAndPublish()
 
@@ -202,12 +377,28 @@ type tracingPublisher struct {
 	segment tracer.Segment
 }
 
-// WithTraceReceiveNotices returns a Supervisor that ping when Check is invoked
+// tracingReporter is a tracingPublisher whose target also reports Stats
+type tracingReporter struct {
+	*tracingPublisher
+	reporter StatsReporter
+}
+
+func (s *tracingReporter) Stats() Stats { return s.reporter.Stats() }
+
+// WithTraceReceiveNotices returns a Supervisor that ping when Check is invoked; the returned
+// Supervisor is a StatsReporter if s is
 func WithTraceReceiveNotices(s Supervisor, segment tracer.Segment) Supervisor {
-	return &tracingPublisher{
+	publisher := &tracingPublisher{
 		target:  s,
 		segment: segment,
 	}
+	if reporter, ok := s.(StatsReporter); ok {
+		return &tracingReporter{
+			tracingPublisher: publisher,
+			reporter:         reporter,
+		}
+	}
+	return publisher
 }
 
 func (s *tracingPublisher) Close() error          { return s.target.Close() }
@@ -219,31 +410,7 @@ func (s *tracingPublisher) Check() {
 
 // WithReceiveNotifications listens to nats for notices on the StreamSubject and prods the supervisor
 func WithReceiveNotifications(s Supervisor, nc *nats.Conn, env, boundedContext string) Supervisor {
-	go func() {
-		subject := NoticesSubject(env, boundedContext)
-		fn := func(m *nats.Msg) {
-			s.Check()
-		}
-
-		var sub *nats.Subscription
-		for {
-			select {
-			case <-s.Done():
-				return
-			default:
-			}
-
-			if v, err := nc.Subscribe(subject, fn); err == nil {
-				sub = v
-				break
-			}
-		}
-
-		<-s.Done()
-		sub.Unsubscribe()
-	}()
-
-	return s
+	return WithReceiveNotices(s, NatsNotices(nc, env, boundedContext))
 }
 
 // PublishStan publishes events to the nats stream identified with the env and boundedContext
@@ -253,26 +420,14 @@ func PublishStan(st stan.Conn, subject string) PublisherFunc {
 	}
 }
 
-// PublishStreamSingleton is similar to PublishStream except that there may be only one running in the environment
-func PublishStreamSingleton(ctx context.Context, p Publisher, r eventsource.StreamReader, cp *checkpoint.CP, env, bc string, nc *nats.Conn) error {
-	segment, ctx := tracer.NewSegment(ctx, "publish_stream")
-	segment.SetBaggageItem("subject", StreamSubject(env, bc))
-	defer segment.Finish()
-
-	a := action.Action(func(ctx context.Context) error {
-		h := WithPublishEvents(p, nc, env, bc)              // publish events to here
-		supervisor := PublishStream(ctx, h, r, cp, env, bc) // go!
-		if env == "local" {                                 // in the local env
-			supervisor = WithTraceReceiveNotices(supervisor, segment) // configuration addition logging
-		}
-		supervisor = WithReceiveNotifications(supervisor, nc, env, bc) // ping the supervisor when events received
-		<-supervisor.Done()                                            // wait until done
-		return nil
-	})
-	singleton := action.Singleton(heartbeat.Nats(nc, makeTickerSubject(env, bc)))
-	forever := action.Forever(time.Second * 3)
-
-	return a.Use(singleton, forever).Do(ctx)
+// PublishStreamSingleton is similar to PublishStream except that there may be only one running in the environment;
+// uses nats for the heartbeat and notifications, see PublishStreamSingletonWith for other transports
+func PublishStreamSingleton(ctx context.Context, p Publisher, r eventsource.StreamReader, cp Checkpointer, env, bc string, nc *nats.Conn) error {
+	return PublishStreamSingletonWith(ctx, p, r, cp, env, bc,
+		heartbeat.Nats(nc, makeTickerSubject(env, bc)),
+		WithNotifier(NatsNotifier(nc, env, bc)),
+		WithNotices(NatsNotices(nc, env, bc)),
+	)
 }
 
 func makeCheckpointKey(env, bc string) string {
@@ -1,6 +1,7 @@
 package eventsourcex_test
 
 import (
+	"bytes"
 	"context"
 	"sync/atomic"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/altairsix/eventsource"
 	"github.com/altairsix/pkg/eventsourcex"
 	"github.com/nats-io/go-nats"
+	"github.com/opentracing/opentracing-go"
 	"github.com/savaki/randx"
 	"github.com/stretchr/testify/assert"
 )
@@ -45,6 +47,91 @@ func TestPublisher(t *testing.T) {
 	assert.Equal(t, records[0], received[0])
 }
 
+type batchPublisher struct {
+	eventsourcex.PublisherFunc
+	batches chan []eventsource.StreamRecord
+}
+
+func (b batchPublisher) PublishBatch(records []eventsource.StreamRecord) error {
+	b.batches <- records
+	return nil
+}
+
+func TestPublisherBatch(t *testing.T) {
+	h := batchPublisher{
+		PublisherFunc: func(record eventsource.StreamRecord) error {
+			t.Fatal("expected records to be published as a batch")
+			return nil
+		},
+		batches: make(chan []eventsource.StreamRecord, 10),
+	}
+
+	records := []eventsource.StreamRecord{
+		{Offset: 1, AggregateID: "abc"},
+		{Offset: 2, AggregateID: "abc"},
+	}
+	r := eventsource.StreamReaderFunc(func(ctx context.Context, startingOffset uint64, recordCount int) ([]eventsource.StreamRecord, error) {
+		if startingOffset > 1 {
+			return nil, nil
+		}
+		return records, nil
+	})
+
+	supervisor := eventsourcex.PublishStream(context.Background(), h, r, eventsourcex.MemoryCP{}, "local", randx.AlphaN(20))
+	defer supervisor.Close()
+
+	supervisor.Check()
+	select {
+	case batch := <-h.batches:
+		assert.Equal(t, records, batch)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for batch")
+	}
+}
+
+type contextKey struct{}
+
+// contextPublisher records the contexts records are published with
+type contextPublisher struct {
+	eventsourcex.PublisherFunc
+	contexts chan context.Context
+}
+
+func (c contextPublisher) PublishContext(ctx context.Context, record eventsource.StreamRecord) error {
+	c.contexts <- ctx
+	return nil
+}
+
+func TestPublisherContext(t *testing.T) {
+	h := contextPublisher{
+		PublisherFunc: func(record eventsource.StreamRecord) error {
+			t.Fatal("expected records to be published with the supervisor context")
+			return nil
+		},
+		contexts: make(chan context.Context, 10),
+	}
+
+	r := eventsource.StreamReaderFunc(func(ctx context.Context, startingOffset uint64, recordCount int) ([]eventsource.StreamRecord, error) {
+		if startingOffset > 1 {
+			return nil, nil
+		}
+		return []eventsource.StreamRecord{{Offset: 1, AggregateID: "abc"}}, nil
+	})
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "value")
+	supervisor := eventsourcex.PublishStream(ctx, h, r, eventsourcex.MemoryCP{}, "local", randx.AlphaN(20))
+	defer supervisor.Close()
+
+	supervisor.Check()
+	select {
+	case got := <-h.contexts:
+		assert.Equal(t, "value", got.Value(contextKey{}))
+		assert.NotNil(t, opentracing.SpanFromContext(got), "expected the supervisor's trace context")
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for publish")
+	}
+}
+
 type mockPublisher struct {
 	checkCalled int32
 	closeCalled int32
@@ -118,3 +205,54 @@ func TestPublishEvents(t *testing.T) {
 	time.Sleep(time.Millisecond * 50)
 	assert.Equal(t, int32(1), received, "expected message to have been propagated")
 }
+
+func TestPublishStreamCatchUp(t *testing.T) {
+	var records []eventsource.StreamRecord
+	for i := 1; i <= 250; i++ {
+		records = append(records, eventsource.StreamRecord{Offset: uint64(i), AggregateID: "abc"})
+	}
+
+	reads := make(chan int, 10)
+	r := eventsource.StreamReaderFunc(func(ctx context.Context, startingOffset uint64, recordCount int) ([]eventsource.StreamRecord, error) {
+		reads <- recordCount
+		from := int(startingOffset) - 1
+		if from >= len(records) {
+			return nil, nil
+		}
+		to := from + recordCount
+		if to > len(records) {
+			to = len(records)
+		}
+		return records[from:to], nil
+	})
+
+	published := make(chan uint64, len(records))
+	h := eventsourcex.PublisherFunc(func(record eventsource.StreamRecord) error {
+		published <- record.Offset
+		return nil
+	})
+
+	w := &bytes.Buffer{}
+	cp := eventsourcex.MemoryCP{}
+	supervisor := eventsourcex.PublishStream(context.Background(), h, r, cp, "local", "bc",
+		eventsourcex.WithPageSize(100),
+		eventsourcex.WithCommitInterval(0),
+		eventsourcex.WithPublishInterval(time.Hour),
+		eventsourcex.WithOutput(w),
+	)
+
+	// a single check drains the backlog; two full pages then a partial one
+	supervisor.Check()
+	for i := 0; i < len(records); i++ {
+		select {
+		case <-published:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out after %v records published", i)
+		}
+	}
+	supervisor.Close()
+
+	assert.Equal(t, 100, <-reads)
+	assert.Equal(t, uint64(250), cp["stan:local.bc"])
+	assert.Contains(t, w.String(), "published 250 records through offset 250")
+}
@@ -0,0 +1,159 @@
+package eventsourcex
+
+import (
+	"context"
+	"time"
+
+	"github.com/altairsix/eventsource"
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/nats-io/go-nats"
+)
+
+// Notifier announces that an event has been published
+type Notifier interface {
+	Notify(record eventsource.StreamRecord) error
+}
+
+// NotifierFunc provides a func wrapper to Notifier
+type NotifierFunc func(record eventsource.StreamRecord) error
+
+// Notify implements the Notifier interface
+func (fn NotifierFunc) Notify(record eventsource.StreamRecord) error { return fn(record) }
+
+// Notices delivers notices that new events may be available in the stream
+type Notices interface {
+	// Subscribe invokes fn for each notice received until unsubscribe is called
+	Subscribe(fn func()) (unsubscribe func(), err error)
+}
+
+// NoticesFunc provides a func wrapper to Notices
+type NoticesFunc func(fn func()) (func(), error)
+
+// Subscribe implements the Notices interface
+func (fn NoticesFunc) Subscribe(callback func()) (func(), error) { return fn(callback) }
+
+// NatsNotifier publishes the aggregate id of each record to the nats StreamSubject
+func NatsNotifier(nc *nats.Conn, env, boundedContext string) NotifierFunc {
+	rootSubject := StreamSubject(env, boundedContext) + "."
+
+	return func(record eventsource.StreamRecord) error {
+		return nc.Publish(rootSubject+record.AggregateID, []byte(record.AggregateID))
+	}
+}
+
+// NatsNotices receives notices from the nats NoticesSubject
+func NatsNotices(nc *nats.Conn, env, boundedContext string) NoticesFunc {
+	subject := NoticesSubject(env, boundedContext)
+
+	return func(fn func()) (func(), error) {
+		sub, err := nc.Subscribe(subject, func(m *nats.Msg) { fn() })
+		if err != nil {
+			return nil, err
+		}
+		return func() { sub.Unsubscribe() }, nil
+	}
+}
+
+// WithNotify notifies once each record has been published; notification is best effort, errors
+// returned by the Notifier are not returned to the caller
+func WithNotify(p Publisher, n Notifier) PublisherFunc {
+	return func(record eventsource.StreamRecord) error {
+		if err := p.Publish(record); err != nil {
+			return err
+		}
+
+		go n.Notify(record)
+		return nil
+	}
+}
+
+// WithReceiveNotices prods the supervisor each time a notice is received; subscribing is retried
+// until it succeeds or the supervisor is done
+func WithReceiveNotices(s Supervisor, n Notices) Supervisor {
+	go func() {
+		var unsubscribe func()
+		for {
+			v, err := n.Subscribe(s.Check)
+			if err == nil {
+				unsubscribe = v
+				break
+			}
+
+			select {
+			case <-s.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+
+		<-s.Done()
+		unsubscribe()
+	}()
+
+	return s
+}
+
+// WithNotifier announces each record once it has been published
+func WithNotifier(n Notifier) PublishOption {
+	return func(o *publishOptions) {
+		o.notifier = n
+	}
+}
+
+// WithNotices checks the stream each time a notice is received rather than waiting for the
+// publish interval
+func WithNotices(n Notices) PublishOption {
+	return func(o *publishOptions) {
+		o.notices = n
+	}
+}
+
+// WithSingleton configures the election of the instance that publishes e.g. action.WithElections
+func WithSingleton(opts ...action.SingletonOption) PublishOption {
+	return func(o *publishOptions) {
+		o.singleton = append(o.singleton, opts...)
+	}
+}
+
+// WithSupervisor calls fn with the Supervisor each time this instance is elected and begins
+// publishing.  The Supervisor is a StatsReporter and so may be served with StatsHandler; it stops
+// once this instance is no longer elected.
+func WithSupervisor(fn func(s Supervisor)) PublishOption {
+	return func(o *publishOptions) {
+		o.onSupervisor = fn
+	}
+}
+
+// PublishStreamSingletonWith is similar to PublishStream except that there may be only one running in
+// the environment; the heartbeat elects the instance that publishes
+func PublishStreamSingletonWith(ctx context.Context, p Publisher, r eventsource.StreamReader, cp Checkpointer, env, bc string, hb action.Heartbeat, opts ...PublishOption) error {
+	cfg := newPublishOptions(opts...)
+
+	segment, ctx := tracer.NewSegment(ctx, "publish_stream")
+	segment.SetBaggageItem("subject", StreamSubject(env, bc))
+	defer segment.Finish()
+
+	a := action.Action(func(ctx context.Context) error {
+		h := p
+		if cfg.notifier != nil {
+			h = WithNotify(p, cfg.notifier) // announce published events
+		}
+		supervisor := PublishStream(ctx, h, r, cp, env, bc, opts...) // go!
+		if env == "local" {                                          // in the local env
+			supervisor = WithTraceReceiveNotices(supervisor, segment) // configuration addition logging
+		}
+		if cfg.notices != nil {
+			supervisor = WithReceiveNotices(supervisor, cfg.notices) // ping the supervisor when events received
+		}
+		if cfg.onSupervisor != nil {
+			cfg.onSupervisor(supervisor) // expose the supervisor, and its stats, to the caller
+		}
+		<-supervisor.Done() // wait until done
+		return nil
+	})
+	singleton := action.Singleton(hb, cfg.singleton...)
+	forever := action.Forever(time.Second * 3)
+
+	return a.Use(singleton, forever).Do(ctx)
+}
@@ -0,0 +1,125 @@
+package eventsourcex_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/altairsix/eventsource"
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/action/heartbeat"
+	"github.com/altairsix/pkg/eventsourcex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishStreamSingletonWith(t *testing.T) {
+	record := eventsource.StreamRecord{Offset: 1, AggregateID: "abc"}
+	available := make(chan struct{})
+	r := eventsource.StreamReaderFunc(func(ctx context.Context, startingOffset uint64, recordCount int) ([]eventsource.StreamRecord, error) {
+		select {
+		case <-available:
+			if startingOffset <= record.Offset {
+				return []eventsource.StreamRecord{record}, nil
+			}
+		default:
+		}
+		return nil, nil
+	})
+
+	published := make(chan eventsource.StreamRecord, 1)
+	p := eventsourcex.PublisherFunc(func(record eventsource.StreamRecord) error {
+		published <- record
+		return nil
+	})
+
+	notified := make(chan string, 1)
+	notifier := eventsourcex.NotifierFunc(func(record eventsource.StreamRecord) error {
+		notified <- record.AggregateID
+		return nil
+	})
+
+	subscribed := make(chan func(), 1)
+	notices := eventsourcex.NoticesFunc(func(fn func()) (func(), error) {
+		subscribed <- fn
+		return func() {}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- eventsourcex.PublishStreamSingletonWith(ctx, p, r, eventsourcex.MemoryCP{}, "local", "bc",
+			heartbeat.Memory().Node("a"),
+			eventsourcex.WithNotifier(notifier),
+			eventsourcex.WithNotices(notices),
+			eventsourcex.WithSingleton(action.WithInterval(time.Millisecond*10), action.WithElections(time.Millisecond*50)),
+		)
+	}()
+
+	var check func()
+	select {
+	case check = <-subscribed:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for the elected publisher to subscribe to notices")
+	}
+
+	// a notice prompts the publisher to read the newly available record
+	close(available)
+	check()
+
+	select {
+	case v := <-published:
+		assert.Equal(t, record, v)
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for record to be published")
+	}
+	assert.Equal(t, "abc", <-notified)
+
+	cancel()
+	assert.Nil(t, <-done)
+}
+
+func TestPublishStreamSingletonWithSupervisor(t *testing.T) {
+	r := headReader{
+		StreamReaderFunc: func(ctx context.Context, startingOffset uint64, recordCount int) ([]eventsource.StreamRecord, error) {
+			return nil, nil
+		},
+		err: io.ErrUnexpectedEOF,
+	}
+	p := eventsourcex.PublisherFunc(func(record eventsource.StreamRecord) error { return nil })
+
+	supervisors := make(chan eventsourcex.Supervisor, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- eventsourcex.PublishStreamSingletonWith(ctx, p, r, eventsourcex.MemoryCP{}, "local", "bc",
+			heartbeat.Memory().Node("a"),
+			eventsourcex.WithPublishInterval(time.Millisecond*10),
+			eventsourcex.WithSingleton(action.WithInterval(time.Millisecond*10), action.WithElections(time.Millisecond*50)),
+			eventsourcex.WithSupervisor(func(s eventsourcex.Supervisor) { supervisors <- s }),
+		)
+	}()
+
+	var supervisor eventsourcex.Supervisor
+	select {
+	case supervisor = <-supervisors:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for the elected publisher's supervisor")
+	}
+
+	reporter, ok := supervisor.(eventsourcex.StatsReporter)
+	assert.True(t, ok, "expected the supervisor to report stats")
+
+	timeout := time.After(time.Second * 5)
+	for reporter.Stats().LastError == "" {
+		select {
+		case <-timeout:
+			t.Fatal("timed out waiting for the head offset error")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	assert.Contains(t, reporter.Stats().LastError, "head offset")
+
+	cancel()
+	assert.Nil(t, <-done)
+}
@@ -0,0 +1,68 @@
+package eventsourcex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// HeadReader may be implemented by StreamReaders that can report the offset of the most recent
+// record in the stream; allows the Supervisor to report its lag
+type HeadReader interface {
+	HeadOffset(ctx context.Context) (uint64, error)
+}
+
+// StatsReporter is implemented by Supervisors that report their progress, such as those returned
+// by PublishStream or passed to the WithSupervisor callback
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// Stats describes the progress of a Supervisor
+type Stats struct {
+	// Offset of the last record published
+	Offset uint64 `json:"offset"`
+
+	// CommittedOffset and CommittedAt describe the last offset saved to the Checkpointer
+	CommittedOffset uint64    `json:"committed_offset"`
+	CommittedAt     time.Time `json:"committed_at"`
+
+	// Published counts the records published since the Supervisor started
+	Published uint64 `json:"published"`
+
+	// CheckedAt is the time of the last read of the stream that completed without error
+	CheckedAt time.Time `json:"checked_at"`
+
+	// LastError and LastErrorAt describe the most recent failure
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at"`
+
+	// HeadOffset and Lag are only reported when the StreamReader implements HeadReader
+	HeadOffset uint64 `json:"head_offset,omitempty"`
+	Lag        uint64 `json:"lag,omitempty"`
+}
+
+// Healthy returns true unless the most recent attempt to publish failed
+func (s Stats) Healthy() bool {
+	return s.LastErrorAt.IsZero() || s.CheckedAt.After(s.LastErrorAt)
+}
+
+// StatsHandler serves the Supervisor's Stats as json; responds with 503 Service Unavailable when the
+// supervisor is not Healthy and 501 Not Implemented if the supervisor is not a StatsReporter
+func StatsHandler(s Supervisor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reporter, ok := s.(StatsReporter)
+		if !ok {
+			http.Error(w, "supervisor does not report stats", http.StatusNotImplemented)
+			return
+		}
+		stats := reporter.Stats()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !stats.Healthy() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(stats)
+	})
+}
@@ -0,0 +1,147 @@
+package eventsourcex_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/altairsix/eventsource"
+	"github.com/altairsix/pkg/eventsourcex"
+	"github.com/stretchr/testify/assert"
+)
+
+type headReader struct {
+	eventsource.StreamReaderFunc
+	head uint64
+	err  error
+}
+
+func (h headReader) HeadOffset(ctx context.Context) (uint64, error) {
+	return h.head, h.err
+}
+
+func TestSupervisorStats(t *testing.T) {
+	records := []eventsource.StreamRecord{
+		{Offset: 1, AggregateID: "abc"},
+		{Offset: 2, AggregateID: "abc"},
+		{Offset: 3, AggregateID: "abc"},
+	}
+	r := headReader{
+		StreamReaderFunc: func(ctx context.Context, startingOffset uint64, recordCount int) ([]eventsource.StreamRecord, error) {
+			if int(startingOffset) > len(records) {
+				return nil, nil
+			}
+			return records[startingOffset-1:], nil
+		},
+		head: 10,
+	}
+
+	failing := int32(0)
+	h := eventsourcex.PublisherFunc(func(record eventsource.StreamRecord) error {
+		if atomic.LoadInt32(&failing) == 1 && record.Offset == 3 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+
+	atomic.StoreInt32(&failing, 1)
+	supervisor := eventsourcex.PublishStream(context.Background(), h, r, eventsourcex.MemoryCP{}, "local", "bc",
+		eventsourcex.WithCommitInterval(0),
+		eventsourcex.WithPublishInterval(time.Hour),
+	)
+	defer supervisor.Close()
+
+	waitFor := func(label string, fn func(stats eventsourcex.Stats) bool) eventsourcex.Stats {
+		timeout := time.After(time.Second * 5)
+		for {
+			stats := supervisor.(eventsourcex.StatsReporter).Stats()
+			if fn(stats) {
+				return stats
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("timed out waiting for %v; got %#v", label, stats)
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+	}
+
+	// publishing stalls at offset 3
+	supervisor.Check()
+	stats := waitFor("error", func(stats eventsourcex.Stats) bool { return stats.LastError != "" })
+	assert.False(t, stats.Healthy())
+	assert.Equal(t, uint64(2), stats.Offset)
+	assert.Equal(t, uint64(2), stats.Published)
+	assert.Contains(t, stats.LastError, io.ErrUnexpectedEOF.Error())
+
+	server := httptest.NewServer(eventsourcex.StatsHandler(supervisor))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp.Body.Close()
+
+	// recovers
+	atomic.StoreInt32(&failing, 0)
+	supervisor.Check()
+	stats = waitFor("recovery", func(stats eventsourcex.Stats) bool { return stats.Healthy() && stats.HeadOffset > 0 })
+	assert.Equal(t, uint64(3), stats.Offset)
+	assert.Equal(t, uint64(3), stats.CommittedOffset)
+	assert.Equal(t, uint64(3), stats.Published)
+	assert.Equal(t, uint64(10), stats.HeadOffset)
+	assert.Equal(t, uint64(7), stats.Lag)
+
+	resp, err = http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body map[string]interface{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, float64(7), body["lag"])
+	assert.Equal(t, float64(3), body["offset"])
+}
+
+func TestSupervisorStatsHeadError(t *testing.T) {
+	r := headReader{
+		StreamReaderFunc: func(ctx context.Context, startingOffset uint64, recordCount int) ([]eventsource.StreamRecord, error) {
+			return nil, nil
+		},
+		err: io.ErrUnexpectedEOF,
+	}
+	h := eventsourcex.PublisherFunc(func(record eventsource.StreamRecord) error { return nil })
+
+	supervisor := eventsourcex.PublishStream(context.Background(), h, r, eventsourcex.MemoryCP{}, "local", "bc",
+		eventsourcex.WithPublishInterval(time.Hour),
+	)
+	defer supervisor.Close()
+
+	supervisor.Check()
+	timeout := time.After(time.Second * 5)
+	for {
+		stats := supervisor.(eventsourcex.StatsReporter).Stats()
+		if stats.LastError != "" {
+			assert.Contains(t, stats.LastError, "head offset")
+			assert.False(t, stats.Healthy())
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("timed out waiting for head offset error; got %#v", stats)
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func TestStatsHandlerNotReporter(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	eventsourcex.StatsHandler(&mockPublisher{}).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
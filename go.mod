@@ -1,41 +1,50 @@
 module github.com/altairsix/pkg
 
+go 1.27.1
+
 require (
 	github.com/Shopify/sarama v1.17.0
 	github.com/altairsix/eventsource v0.0.0-20170815104732-7b6859b7a009
 	github.com/apex/go-apex v1.0.0
 	github.com/aws/aws-sdk-go v1.15.26
 	github.com/bsm/sarama-cluster v2.1.15+incompatible
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/eapache/go-resiliency v1.1.0 // indirect
-	github.com/eapache/go-xerial-snappy v0.0.0-20180814174437-776d5712da21 // indirect
-	github.com/eapache/queue v1.1.0 // indirect
 	github.com/go-sql-driver/mysql v1.4.0
-	github.com/gogo/protobuf v1.1.1 // indirect
-	github.com/golang/protobuf v1.2.0 // indirect
-	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db // indirect
 	github.com/gorilla/securecookie v1.1.1
 	github.com/gorilla/sessions v1.1.1
 	github.com/jinzhu/gorm v1.9.1
-	github.com/jinzhu/inflection v0.0.0-20180308033659-04140366298a // indirect
 	github.com/julienschmidt/httprouter v0.0.0-20180715161854-348b672cd90d
+	github.com/montanaflynn/stats v0.12.7
 	github.com/nats-io/go-nats v1.6.0
 	github.com/nats-io/go-nats-streaming v0.4.0
-	github.com/nats-io/nuid v1.0.0 // indirect
 	github.com/opentracing/opentracing-go v1.0.2
-	github.com/pierrec/lz4 v2.0.4+incompatible // indirect
 	github.com/pkg/errors v0.8.0
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/rcrowley/go-metrics v0.0.0-20180503174638-e2704e165165 // indirect
 	github.com/savaki/jq v0.0.0-20161209013833-0e6baecebbf8
 	github.com/savaki/nats-protobuf v0.0.0-20170723155305-4007d0ad6633
 	github.com/savaki/randx v0.0.0-20170329201315-c1002dbb5fae
 	github.com/savaki/swag v0.0.0-20170722173931-3a75479e44a3
 	github.com/segmentio/ksuid v1.0.1
 	github.com/stretchr/testify v1.2.2
+	go.uber.org/zap v1.9.1
+	gopkg.in/asaskevich/govalidator.v4 v4.0.0-20160518190739-766470278477
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/eapache/go-resiliency v1.1.0 // indirect
+	github.com/eapache/go-xerial-snappy v0.0.0-20180814174437-776d5712da21 // indirect
+	github.com/eapache/queue v1.1.0 // indirect
+	github.com/go-ini/ini v1.25.4 // indirect
+	github.com/gogo/protobuf v1.1.1 // indirect
+	github.com/golang/protobuf v1.2.0 // indirect
+	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db // indirect
+	github.com/gorilla/context v1.1.1 // indirect
+	github.com/jinzhu/inflection v0.0.0-20180308033659-04140366298a // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20160202185014-0b12d6b521d8 // indirect
+	github.com/nats-io/nuid v1.0.0 // indirect
+	github.com/pierrec/lz4 v2.0.4+incompatible // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rcrowley/go-metrics v0.0.0-20180503174638-e2704e165165 // indirect
 	go.uber.org/atomic v1.3.2 // indirect
 	go.uber.org/multierr v1.1.0 // indirect
-	go.uber.org/zap v1.9.1
 	golang.org/x/net v0.0.0-20180826012351-8a410e7b638d // indirect
-	gopkg.in/asaskevich/govalidator.v4 v4.0.0-20160518190739-766470278477
 )
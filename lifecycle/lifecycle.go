@@ -0,0 +1,286 @@
+// Package lifecycle runs the components of a process and shuts them down gracefully when the
+// process receives a signal.
+//
+//	lc := lifecycle.New(context.Background())
+//	lc.Go("http", server)
+//	lc.Wait("publisher", supervisor.Done())
+//	lc.OnShutdown("subscription", subscription.Shutdown)
+//	lc.OnShutdown("logger", lifecycle.Func(k.Logger.Sync))
+//	if err := lc.Run(); err != nil {
+//		log.Fatalln(err)
+//	}
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+)
+
+// HookFunc is called during shutdown; ctx expires when the hook deadline is reached
+type HookFunc func(ctx context.Context) error
+
+// Func adapts a func that takes no context, such as (*zap.Logger).Sync, to a HookFunc
+func Func(fn func() error) HookFunc {
+	return func(ctx context.Context) error {
+		return fn()
+	}
+}
+
+// ErrHung is returned by Run when components fail to stop before the shutdown deadline
+type ErrHung struct {
+	// Components holds the names of the components and hooks that had not finished
+	Components []string
+}
+
+// Error implements the error interface
+func (e *ErrHung) Error() string {
+	return "shutdown deadline exceeded; hung components: " + strings.Join(e.Components, ", ")
+}
+
+// IsHung returns true if err, or any of its causes, is an *ErrHung
+func IsHung(err error) bool {
+	return tracer.HasErr(err, func(err error) bool {
+		_, ok := err.(*ErrHung)
+		return ok
+	})
+}
+
+// Option provides functional options to New
+type Option func(*Lifecycle)
+
+// WithDeadline specifies how long to wait for components to finish once shutdown begins; defaults
+// to 30s
+func WithDeadline(d time.Duration) Option {
+	return func(l *Lifecycle) {
+		l.deadline = d
+	}
+}
+
+// WithHookDeadline specifies how long the shutdown hooks are given to finish.  The hook deadline
+// starts once the components have finished, or the component deadline has expired, so hooks run
+// even when a component hangs.  Defaults to the component deadline.
+func WithHookDeadline(d time.Duration) Option {
+	return func(l *Lifecycle) {
+		l.hookDeadline = d
+	}
+}
+
+// WithSignals specifies the signals that initiate shutdown; defaults to SIGINT and SIGTERM
+func WithSignals(signals ...os.Signal) Option {
+	return func(l *Lifecycle) {
+		l.signals = signals
+	}
+}
+
+type component struct {
+	name string
+	done <-chan struct{}
+}
+
+type hook struct {
+	name string
+	fn   HookFunc
+}
+
+type exit struct {
+	name string
+	err  error
+}
+
+// Lifecycle manages the components of a process
+type Lifecycle struct {
+	ctx          context.Context
+	cancel       func()
+	deadline     time.Duration
+	hookDeadline time.Duration
+	signals      []os.Signal
+	exits        chan exit
+
+	mutex      sync.Mutex
+	components []component
+	hooks      []hook
+}
+
+// New returns a new Lifecycle whose context is derived from the ctx provided
+func New(ctx context.Context, opts ...Option) *Lifecycle {
+	ctx, cancel := context.WithCancel(ctx)
+	l := &Lifecycle{
+		ctx:      ctx,
+		cancel:   cancel,
+		deadline: time.Second * 30,
+		signals:  []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+		exits:    make(chan exit, 1),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.hookDeadline <= 0 {
+		l.hookDeadline = l.deadline
+	}
+
+	return l
+}
+
+// Context returns the root context of the process; it is canceled when shutdown begins.  Use it
+// to start components, such as an eventsourcex.Supervisor, that are then registered with Wait.
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// Go runs the action as a named component.  The action's context is canceled when shutdown
+// begins.  If the action returns before shutdown begins, the Lifecycle shuts down.
+func (l *Lifecycle) Go(name string, a action.Action) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		err := a.Do(l.ctx)
+		if l.ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case l.exits <- exit{name: name, err: err}:
+		default:
+		}
+	}()
+
+	l.Wait(name, done)
+}
+
+// Wait registers a named component that is finished once done is closed e.g. the channel returned
+// by eventsourcex.Supervisor.Done or queue.Start
+func (l *Lifecycle) Wait(name string, done <-chan struct{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.components = append(l.components, component{name: name, done: done})
+}
+
+// OnShutdown registers a hook to be called after all components have finished, or the component
+// deadline has expired.  Hooks are called one at a time in the order they were registered e.g.
+// kafka.Subscription.Shutdown followed by a logger flush.
+func (l *Lifecycle) OnShutdown(name string, fn HookFunc) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.hooks = append(l.hooks, hook{name: name, fn: fn})
+}
+
+// Shutdown initiates shutdown; Run returns once shutdown completes
+func (l *Lifecycle) Shutdown() {
+	l.cancel()
+}
+
+// Run blocks until a signal is received, the parent context is canceled, Shutdown is called, or
+// a component started with Go exits.  It then cancels the root context, waits for the components
+// to finish, and calls the shutdown hooks.  Components and hooks each have their own deadline; if
+// either expires, Run returns an *ErrHung naming the components and hooks still running.
+func (l *Lifecycle) Run() error {
+	segment, _ := tracer.NewSegment(context.Background(), "lifecycle:run")
+	defer segment.Finish()
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, l.signals...)
+	defer signal.Stop(ch)
+
+	var err error
+	select {
+	case sig := <-ch:
+		segment.Info("lifecycle:signal", log.String("signal", sig.String()))
+	case <-l.ctx.Done():
+		segment.Info("lifecycle:canceled")
+	case e := <-l.exits:
+		segment.Info("lifecycle:component_exited", log.String("component", e.name))
+		if e.err != nil {
+			err = errors.Wrapf(e.err, "component, %v, failed", e.name)
+		} else {
+			err = errors.Errorf("component, %v, exited", e.name)
+		}
+	}
+	l.cancel()
+
+	if shutdownErr := l.shutdown(segment); shutdownErr != nil {
+		return shutdownErr
+	}
+	return err
+}
+
+func (l *Lifecycle) shutdown(segment tracer.Segment) error {
+	l.mutex.Lock()
+	components := append([]component(nil), l.components...)
+	hooks := append([]hook(nil), l.hooks...)
+	l.mutex.Unlock()
+
+	hung := l.waitComponents(segment, components)
+
+	hookHung, err := l.callHooks(segment, hooks)
+	hung = append(hung, hookHung...)
+
+	if len(hung) > 0 {
+		return &ErrHung{Components: hung}
+	}
+	return err
+}
+
+// waitComponents waits up to the component deadline for the components to finish and returns the
+// names of those still running
+func (l *Lifecycle) waitComponents(segment tracer.Segment, components []component) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), l.deadline)
+	defer cancel()
+
+	var hung []string
+	for _, c := range components {
+		select {
+		case <-c.done:
+			segment.Info("lifecycle:stopped", log.String("component", c.name))
+		case <-ctx.Done():
+			segment.Info("lifecycle:hung", log.String("component", c.name))
+			hung = append(hung, c.name)
+		}
+	}
+
+	return hung
+}
+
+// callHooks calls the hooks, in order, within the hook deadline and returns the names of the hooks
+// still running along with the first hook error
+func (l *Lifecycle) callHooks(segment tracer.Segment, hooks []hook) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.hookDeadline)
+	defer cancel()
+
+	var hung []string
+	var err error
+	for _, h := range hooks {
+		result := make(chan error, 1)
+		go func(fn HookFunc) {
+			result <- fn(ctx)
+		}(h.fn)
+
+		select {
+		case v := <-result:
+			if v != nil {
+				segment.Info("lifecycle:hook_failed", log.String("hook", h.name), log.Error(v))
+				if err == nil {
+					err = errors.Wrapf(v, "shutdown hook, %v, failed", h.name)
+				}
+			}
+		case <-ctx.Done():
+			segment.Info("lifecycle:hung", log.String("hook", h.name))
+			hung = append(hung, h.name)
+		}
+	}
+
+	return hung, err
+}
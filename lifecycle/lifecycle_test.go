@@ -0,0 +1,129 @@
+package lifecycle_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/altairsix/pkg/lifecycle"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func blocking(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lc := lifecycle.New(ctx)
+
+	var mutex sync.Mutex
+	var events []string
+	record := func(event string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		<-lc.Context().Done()
+		close(done)
+	}()
+
+	lc.Go("action", blocking)
+	lc.Wait("supervisor", done)
+	lc.OnShutdown("subscription", func(ctx context.Context) error {
+		record("subscription")
+		return nil
+	})
+	lc.OnShutdown("logger", lifecycle.Func(func() error {
+		record("logger")
+		return nil
+	}))
+
+	cancel()
+	assert.Nil(t, lc.Run())
+	assert.Equal(t, []string{"subscription", "logger"}, events)
+}
+
+func TestHung(t *testing.T) {
+	lc := lifecycle.New(context.Background(),
+		lifecycle.WithDeadline(time.Millisecond*50),
+		lifecycle.WithHookDeadline(time.Millisecond*50),
+	)
+	lc.Go("ok", blocking)
+	lc.Wait("stuck", make(chan struct{}))
+	lc.OnShutdown("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	lc.Shutdown()
+	err := lc.Run()
+	assert.True(t, lifecycle.IsHung(err))
+	assert.Equal(t, []string{"stuck", "slow"}, err.(*lifecycle.ErrHung).Components)
+}
+
+func TestHookRunsWhenComponentHung(t *testing.T) {
+	lc := lifecycle.New(context.Background(), lifecycle.WithDeadline(time.Millisecond*50))
+	lc.Wait("stuck", make(chan struct{}))
+
+	flushed := false
+	lc.OnShutdown("logger", func(ctx context.Context) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		flushed = true
+		return nil
+	})
+
+	lc.Shutdown()
+	err := lc.Run()
+	assert.True(t, lifecycle.IsHung(err))
+	assert.Equal(t, []string{"stuck"}, err.(*lifecycle.ErrHung).Components)
+	assert.True(t, flushed, "expected hook to run with its own deadline")
+}
+
+func TestComponentFailed(t *testing.T) {
+	hooks := 0
+	lc := lifecycle.New(context.Background())
+	lc.Go("failing", func(ctx context.Context) error {
+		return io.ErrUnexpectedEOF
+	})
+	lc.Go("blocking", blocking)
+	lc.OnShutdown("hook", func(ctx context.Context) error {
+		hooks++
+		return nil
+	})
+
+	err := lc.Run()
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+	assert.Equal(t, 1, hooks)
+}
+
+func TestSignal(t *testing.T) {
+	lc := lifecycle.New(context.Background(), lifecycle.WithSignals(syscall.SIGUSR1))
+	lc.Go("blocking", blocking)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- lc.Run()
+	}()
+
+	// wait for Run to register for the signal
+	time.Sleep(time.Millisecond * 50)
+	assert.Nil(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for shutdown")
+	}
+}
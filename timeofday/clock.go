@@ -15,8 +15,12 @@ type Clock int
 
 // Today returns the Clock for the current day
 func (c Clock) Today() time.Time {
-	now := time.Now()
-	return time.Date(now.Year(), now.Month(), now.Day(), c.Hour(), c.Minute(), c.Second(), 0, now.Location())
+	return c.On(time.Now())
+}
+
+// On returns the Clock for the day of the time provided, in the location of the time provided
+func (c Clock) On(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), c.Hour(), c.Minute(), c.Second(), 0, t.Location())
 }
 
 // Second returns the clock second
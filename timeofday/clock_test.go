@@ -24,3 +24,11 @@ func TestRelativeTimes(t *testing.T) {
 	assert.True(t, clock.GTE(now))
 	assert.False(t, clock.GT(now))
 }
+
+func TestOn(t *testing.T) {
+	loc := time.FixedZone("test", -7*60*60)
+	day := time.Date(2018, 3, 4, 23, 59, 0, 0, loc)
+	clock := timeofday.Clock(10*60*60 + 30*60 + 15)
+
+	assert.Equal(t, time.Date(2018, 3, 4, 10, 30, 15, 0, loc), clock.On(day))
+}
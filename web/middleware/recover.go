@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/altairsix/pkg/action"
+	"github.com/altairsix/pkg/tracer"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
+)
+
+// responseWriter records whether the handler has started the response
+type responseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush implements http.Flusher if the underlying ResponseWriter does
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.written = true
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying ResponseWriter does
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	w.written = true
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying ResponseWriter for use by http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Recover converts panics within the handler into a 500 response rather than allowing them
+// to take down the process.  The panic value and stack are logged to the request's segment.
+// If the handler had already started the response, the response is left as is.  Panics with
+// http.ErrAbortHandler are propagated so that the server aborts the response.
+func Recover(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			pe := action.NewPanicError(v)
+			tracer.SegmentFromContext(req.Context()).LogFields(
+				log.String("event", "http:panic"),
+				log.String("path", req.URL.Path),
+				log.Error(pe),
+				log.String("stack", string(pe.Stack)),
+			)
+
+			if rw.written {
+				return // too late to change the status
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"err": pe.Error(),
+			})
+		}()
+
+		h.ServeHTTP(rw, req)
+	})
+}
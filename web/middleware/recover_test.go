@@ -0,0 +1,53 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/altairsix/pkg/web/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecover(t *testing.T) {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	})
+
+	h := middleware.Recover(fn)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	h.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, `{"err":"panic: boom"}`+"\n", w.Body.String())
+}
+
+func TestRecoverAfterWrite(t *testing.T) {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	middleware.Recover(fn).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "partial", w.Body.String())
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		middleware.Recover(fn).ServeHTTP(w, req)
+	})
+}